@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/state"
+)
+
+// allowCmd represents the allow command
+var allowCmd = &cobra.Command{
+	Use:   "allow [dir]",
+	Short: "Let the shell hook sync a pinned project",
+	Long: `Allow the shell hook (see agents hook) to sync the pinned project of the working
+directory, or of dir.
+
+A project's .agents.yaml and .agents-persona come with the repository, so the hook only
+prints a notice in projects that were not allowed. Changing either file withdraws the
+permission until the project is allowed again. agents sync is not affected.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pin := pinOf(args)
+		hash, err := pin.Hash()
+		if err != nil {
+			fail("Error: %v", err)
+		}
+		if err := state.Allow(pin.Dir, hash); err != nil {
+			fail("Error: failed to save the allowed projects: %v", err)
+		}
+		textf("Allowed %s: the shell hook syncs it to '%s' (run 'agents sync' to apply it now).\n", pin.Dir, pin.Persona)
+		emit(AllowReport{Project: pin.Dir, Persona: pin.Persona, Allowed: true})
+	},
+}
+
+// denyCmd represents the deny command
+var denyCmd = &cobra.Command{
+	Use:   "deny [dir]",
+	Short: "Stop the shell hook from syncing a pinned project",
+	Long:  `Withdraw the permission given by agents allow to the pinned project of the working directory, or of dir.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		pin := pinOf(args)
+		denied, err := state.Deny(pin.Dir)
+		if err != nil {
+			fail("Error: failed to save the allowed projects: %v", err)
+		}
+		if denied {
+			textf("The shell hook no longer syncs %s.\n", pin.Dir)
+		} else {
+			textf("%s was not allowed.\n", pin.Dir)
+		}
+		emit(AllowReport{Project: pin.Dir, Persona: pin.Persona})
+	},
+}
+
+// pinOf returns the pin of the project in the directory given in args, or the working directory
+func pinOf(args []string) *config.Pin {
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	pin, err := config.FindPin(dir)
+	if err != nil {
+		fail("Error: %v", err)
+	}
+	if pin == nil {
+		fail("Error: no pinned persona found (add a %s file or set persona in %s).", config.PinFileName, config.ProjectConfigName)
+	}
+	return pin
+}
+
+func init() {
+	rootCmd.AddCommand(allowCmd)
+	rootCmd.AddCommand(denyCmd)
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/ops"
+)
+
+// autoCmd represents the auto command
+var autoCmd = &cobra.Command{
+	Use:   "auto",
+	Short: "Switch to the persona chosen by the configured rules",
+	Long: `Evaluate the rules of the config in order and switch to the persona of the first rule
+whose conditions all match (working directory, git branch, hostname, environment
+variable, time of day). Nothing happens when that persona is already active.
+
+With --explain every rule and condition is shown and nothing is switched.
+
+Example:
+  agents auto
+  agents auto --explain`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		explain, _ := cmd.Flags().GetBool("explain")
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+
+		if len(Cfg.Rules) == 0 {
+			msg := "No rules configured."
+			textf("%s\n", msg)
+			emit(AutoReport{Rules: []RuleReport{}, Message: msg})
+			return
+		}
+		for i, r := range Cfg.Rules {
+			if r.Persona == "" {
+				fail("Error: rule %s has no persona.", ruleLabel(i, r.Name))
+			}
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			fail("Error: %v", err)
+		}
+		ctx := ops.NewRuleContext(cwd)
+		matches := ops.EvaluateRules(Cfg.Rules, ctx)
+		selected := ops.FirstMatch(matches)
+
+		report := AutoReport{
+			Dir:    ctx.Dir,
+			Branch: ctx.Branch,
+			Host:   ctx.Host,
+			Time:   ctx.Now.Format("15:04"),
+			Active: activePersona(),
+			Rules:  []RuleReport{},
+		}
+		for _, m := range matches {
+			report.Rules = append(report.Rules, ruleReport(m))
+		}
+		if selected != nil {
+			report.Rule = ruleLabel(selected.Index, selected.Rule.Name)
+			report.Persona = selected.Rule.Persona
+		}
+
+		if explain {
+			if structuredOutput() {
+				emit(report)
+				return
+			}
+			printRuleExplanation(report)
+			return
+		}
+
+		switch {
+		case selected == nil:
+			report.Message = "No rule matched."
+		case report.Persona == report.Active:
+			report.Message = fmt.Sprintf("Persona '%s' is already active (rule %s).", report.Persona, report.Rule)
+		}
+		if report.Message != "" {
+			textf("%s\n", report.Message)
+			emit(report)
+			return
+		}
+
+		textf("Rule %s selects persona '%s'.\n", report.Rule, report.Persona)
+		switchPersona("auto", report.Persona, Cfg.Targets, nil, bestEffort)
+	},
+}
+
+func ruleLabel(index int, name string) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("#%d", index+1)
+}
+
+func ruleReport(m ops.RuleMatch) RuleReport {
+	rr := RuleReport{
+		Rule:       ruleLabel(m.Index, m.Rule.Name),
+		Persona:    m.Rule.Persona,
+		Matched:    m.Matched,
+		Conditions: []RuleConditionReport{},
+	}
+	for _, c := range m.Conditions {
+		cr := RuleConditionReport{Condition: c.Condition, Pattern: c.Pattern, Value: c.Value, Matched: c.Matched}
+		if c.Err != nil {
+			cr.Error = c.Err.Error()
+		}
+		rr.Conditions = append(rr.Conditions, cr)
+	}
+	return rr
+}
+
+func printRuleExplanation(report AutoReport) {
+	branch := report.Branch
+	if branch == "" {
+		branch = "-"
+	}
+	fmt.Printf("Evaluating rules in %s (branch %s, host %s, time %s):\n", report.Dir, branch, report.Host, report.Time)
+	for _, r := range report.Rules {
+		result := "no match"
+		if r.Matched {
+			result = "MATCH"
+		}
+		fmt.Printf("  %s -> %s: %s\n", r.Rule, r.Persona, result)
+		if len(r.Conditions) == 0 {
+			fmt.Println("      (no conditions)")
+		}
+		for _, c := range r.Conditions {
+			mark := "no"
+			if c.Matched {
+				mark = "ok"
+			}
+			if c.Error != "" {
+				mark = "error: " + c.Error
+			}
+			fmt.Printf("      %-6s %-20s %s (%s)\n", c.Condition, c.Pattern, c.Value, mark)
+		}
+	}
+
+	switch {
+	case report.Persona == "":
+		fmt.Println("No rule matched.")
+	case report.Persona == report.Active:
+		fmt.Printf("Selected rule %s: persona '%s' (already active).\n", report.Rule, report.Persona)
+	default:
+		fmt.Printf("Selected rule %s: persona '%s' (active: %s).\n", report.Rule, report.Persona, orNone(report.Active))
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(autoCmd)
+
+	autoCmd.Flags().Bool("explain", false, "Show how every rule was evaluated without switching")
+	autoCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// captureCmd represents the capture command
+var captureCmd = &cobra.Command{
+	Use:   "capture <target>",
+	Short: "Write local edits of a copy target back into its persona",
+	Long: `Copy the content of a locally modified copy (or rendered link) target back into the
+source AGENTS.<persona>.md, so the next reconcile does not overwrite the edits.
+A diff of the persona change is shown and must be confirmed unless --yes is given.
+
+Personas whose output is composed (includes, extends or template expressions) cannot be
+captured without flattening them; use --force to do so anyway.
+
+Example:
+  agents capture ~/.claude/CLAUDE.md
+  agents capture --yes ./AGENTS.md`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		yes, _ := cmd.Flags().GetBool("yes")
+		force, _ := cmd.Flags().GetBool("force")
+
+		if structuredOutput() && !yes {
+			fail("Error: --yes is required with --output %s.", outputFormat)
+		}
+
+		st, err := state.LoadState()
+		if err != nil || st == nil {
+			st = &state.StatusState{}
+		}
+
+		canonical := st.CanonicalTarget
+		if canonical == "" {
+			canonical = viper.GetString("target_file")
+		}
+
+		af, target := findTrackedTarget(st, inferPersona(canonical), args[0])
+		if af == nil {
+			fail("Target '%s' is not tracked.", args[0])
+		}
+
+		agentsDirs := agentFileDirs(af, getAgentsDirs())
+		plan, err := planCapture(af.Name, *target, agentsDirs, ops.MergeVars(Cfg.Vars, af.Vars), force)
+		if err != nil {
+			fail("Error: %v", err)
+		}
+
+		report := CaptureReport{
+			Persona:   af.Name,
+			AgentFile: plan.AgentPath,
+			Target:    plan.TargetPath,
+			Diff:      plan.Diff,
+		}
+
+		if plan.Diff == "" {
+			report.Message = "Persona already matches the target."
+			textf("%s\n", report.Message)
+			emit(report)
+			return
+		}
+
+		textf("%s", plan.Diff)
+		if !yes && !confirm(fmt.Sprintf("Write these changes to %s?", plan.AgentPath)) {
+			report.Message = "Capture cancelled."
+			textf("%s\n", report.Message)
+			emit(report)
+			return
+		}
+
+		if err := plan.commit(canonical); err != nil {
+			report.Error = err.Error()
+			textf("Failed to capture: %v\n", err)
+			emit(report)
+			os.Exit(1)
+		}
+
+		report.Captured = true
+		textf("Captured %s into %s\n", plan.TargetPath, plan.AgentPath)
+		emit(report)
+	},
+}
+
+// capturePlan is a pending write of a target's content back into its persona
+type capturePlan struct {
+	Persona    string
+	AgentPath  string
+	TargetPath string
+	Target     state.TargetState
+	Content    []byte
+	Diff       string
+	targetHash string // hash of the target as it is on disk
+	agentsDirs []string
+}
+
+// planCapture checks that target was edited locally and prepares writing it back into persona.
+// It refuses composed personas unless force is set, since capturing would flatten them.
+func planCapture(persona string, target state.TargetState, agentsDirs []string, vars map[string]string, force bool) (*capturePlan, error) {
+	targetPath := ops.ExpandPath(target.Path)
+	if target.Mode != config.TargetModeCopy && !target.Render && target.Hash == "" {
+		return nil, fmt.Errorf("%s is a link to the persona; edits are already in the source", targetPath)
+	}
+	// A target with a variant is captured into the variant
+	source := targetPersona(target, persona)
+
+	agentPath, err := ops.FindPersona(source, agentsDirs)
+	if err != nil {
+		return nil, fmt.Errorf("persona '%s' not found", source)
+	}
+
+	captured, err := os.ReadFile(targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading target: %w", err)
+	}
+	if target.Hash != "" && ops.HashContent(captured) == target.Hash {
+		return nil, fmt.Errorf("%s has no local edits", targetPath)
+	}
+
+	body, err := ops.PersonaBody(agentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !force {
+		expected, err := ops.RenderForTarget(source, agentsDirs, target.TargetConfig(), vars)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(ops.StripMarker(expected), body) {
+			return nil, fmt.Errorf("persona '%s' is composed from includes, parents or templates; capturing would flatten it (use --force)", source)
+		}
+	}
+
+	content := ops.StripMarker(captured)
+	return &capturePlan{
+		Persona:    persona,
+		AgentPath:  agentPath,
+		TargetPath: targetPath,
+		Target:     target,
+		Content:    content,
+		Diff:       ops.UnifiedDiff(agentPath, targetPath, body, content),
+		targetHash: ops.HashContent(captured),
+		agentsDirs: agentsDirs,
+	}, nil
+}
+
+// commit writes the captured content into the persona and records the target as in sync
+func (p *capturePlan) commit(canonical string) error {
+	if err := ops.CapturePersona(p.AgentPath, p.Content); err != nil {
+		return err
+	}
+
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		return err
+	}
+	af, _ := findTrackedTarget(st, p.Persona, p.TargetPath)
+	if af == nil {
+		return nil
+	}
+
+	source := loadPersonaSource(targetPersona(p.Target, p.Persona), p.agentsDirs)
+	for i := range af.Targets {
+		if absPath(af.Targets[i].Path) == p.TargetPath {
+			af.Targets[i].Hash = p.targetHash
+			af.Targets[i].SourceHash = source.Hash
+			af.Targets[i].SourceModTime = source.ModTime
+		}
+	}
+	if st.CanonicalTarget == "" {
+		st.CanonicalTarget = canonical
+	}
+	return state.WriteState(st)
+}
+
+// findTrackedTarget returns the state entry tracking path, preferring the active persona
+func findTrackedTarget(st *state.StatusState, activePersona, path string) (*state.AgentFileState, *state.TargetState) {
+	want := absPath(path)
+
+	var fallback *state.AgentFileState
+	var fallbackTarget *state.TargetState
+	for i := range st.AgentFiles {
+		af := &st.AgentFiles[i]
+		for j := range af.Targets {
+			if absPath(af.Targets[j].Path) != want {
+				continue
+			}
+			if af.Name == activePersona {
+				return af, &af.Targets[j]
+			}
+			if fallback == nil {
+				fallback, fallbackTarget = af, &af.Targets[j]
+			}
+		}
+	}
+	return fallback, fallbackTarget
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func init() {
+	rootCmd.AddCommand(captureCmd)
+
+	captureCmd.Flags().BoolP("yes", "y", false, "Capture without asking for confirmation")
+	captureCmd.Flags().Bool("force", false, "Capture even if the persona is composed (flattens includes, parents and templates)")
+}
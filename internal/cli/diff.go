@@ -0,0 +1,255 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [target]",
+	Short: "Show how targets differ from the active persona",
+	Long: `Show a unified diff between the rendered active persona and each copy target,
+and for link targets which file the link points to versus the expected one.
+Without an argument every tracked target of the active persona is compared.
+
+Example:
+  agents diff
+  agents diff ~/work/repo/AGENTS.md`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := state.LoadState()
+		if err != nil || st == nil {
+			st = &state.StatusState{}
+		}
+
+		canonical := st.CanonicalTarget
+		if canonical == "" {
+			canonical = viper.GetString("target_file")
+		}
+
+		activePersona := inferPersona(canonical)
+		if activePersona == "" {
+			msg := "No active persona found."
+			textf("%s\n", msg)
+			emit(DiffReport{Targets: []DiffTargetReport{}, Message: msg})
+			return
+		}
+
+		agentsDirs := getAgentsDirs()
+		if _, err := ops.FindPersona(activePersona, agentsDirs); err != nil {
+			fail("Error: Persona '%s' not found.", activePersona)
+		}
+
+		// Compare the tracked targets (falling back to the config for untracked personas)
+		var targets []state.TargetState
+		var setVars map[string]string
+		if af := findAgentFile(st, activePersona); af != nil {
+			targets = af.Targets
+			setVars = af.Vars
+			agentsDirs = agentFileDirs(af, agentsDirs)
+		} else {
+			targets = state.TargetStates(Cfg.Targets)
+		}
+		vars := ops.MergeVars(Cfg.Vars, setVars)
+
+		if len(args) == 1 {
+			want := absPath(args[0])
+			var filtered []state.TargetState
+			for _, t := range targets {
+				if absPath(t.Path) == want {
+					filtered = append(filtered, t)
+				}
+			}
+			if len(filtered) == 0 {
+				fail("Target '%s' is not tracked for persona '%s'.", args[0], activePersona)
+			}
+			targets = filtered
+		}
+
+		report := DiffReport{Persona: activePersona, Targets: []DiffTargetReport{}}
+		for _, t := range targets {
+			report.Targets = append(report.Targets, diffTarget(t, activePersona, agentsDirs, vars))
+		}
+
+		if structuredOutput() {
+			emit(report)
+			return
+		}
+
+		for _, tr := range report.Targets {
+			printDiffTarget(tr)
+		}
+	},
+}
+
+// diffTarget compares a single target with what the persona (or its variant for the target) would produce
+func diffTarget(t state.TargetState, persona string, agentsDirs []string, vars map[string]string) DiffTargetReport {
+	targetPath := ops.ExpandPath(t.Path)
+	tr := DiffTargetReport{Path: targetPath, Mode: t.Mode, Status: statusOK}
+	if tr.Mode == "" {
+		tr.Mode = config.TargetModeLink
+	}
+
+	if variant := targetPersona(t, persona); variant != persona {
+		tr.Persona = variant
+		persona = variant
+	}
+	agentPath, err := ops.FindPersona(persona, agentsDirs)
+	if err != nil {
+		tr.Status = statusError
+		tr.Details = fmt.Sprintf("persona '%s' not found", persona)
+		return tr
+	}
+	agentPath, _ = filepath.Abs(agentPath)
+
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			tr.Status = statusMissing
+		} else {
+			tr.Status = statusError
+			tr.Details = err.Error()
+		}
+		return tr
+	}
+
+	if tr.Mode == config.TargetModeLink {
+		// Composed personas are linked through a rendered copy, as for render: true
+		rendered := t.Render
+		if r, err := ops.RenderedLink(persona, agentsDirs, t.TargetConfig(), vars); err == nil {
+			rendered = r
+		}
+		tr.ExpectedLink = agentPath
+		if rendered {
+			if cachePath, err := ops.RenderedPath(persona, targetPath); err == nil {
+				tr.ExpectedLink = cachePath
+			}
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			tr.Status = statusDrift
+			tr.Details = "Not a symlink"
+			return tr
+		}
+		dest, err := os.Readlink(targetPath)
+		if err != nil {
+			tr.Status = statusError
+			tr.Details = fmt.Sprintf("Readlink failed: %v", err)
+			return tr
+		}
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(targetPath), dest)
+		}
+		tr.ActualLink = dest
+		if filepath.Clean(dest) != filepath.Clean(tr.ExpectedLink) {
+			tr.Status = statusDrift
+			return tr
+		}
+		if !rendered {
+			return tr
+		}
+	} else if info.Mode()&os.ModeSymlink != 0 {
+		tr.Status = statusDrift
+		tr.Details = "Is a symlink, expected copy"
+		return tr
+	}
+
+	// Compare content for copy and rendered link targets
+	expected, err := ops.RenderForTarget(persona, agentsDirs, t.TargetConfig(), vars)
+	if err != nil {
+		tr.Status = statusError
+		tr.Details = err.Error()
+		return tr
+	}
+	actual, err := os.ReadFile(targetPath)
+	if err != nil {
+		tr.Status = statusError
+		tr.Details = err.Error()
+		return tr
+	}
+
+	tr.Diff = ops.UnifiedDiff(agentPath, targetPath, expected, actual)
+	if tr.Diff != "" {
+		tr.Status = statusDrift
+	}
+	return tr
+}
+
+func printDiffTarget(tr DiffTargetReport) {
+	switch {
+	case tr.Status == statusMissing:
+		fmt.Printf("%s: missing\n", tr.Path)
+	case tr.Status == statusError:
+		fmt.Printf("%s: error: %s\n", tr.Path, tr.Details)
+	case tr.Details != "":
+		fmt.Printf("%s: %s\n", tr.Path, tr.Details)
+	case tr.Status == statusDrift && tr.Diff == "":
+		fmt.Printf("%s: link\n", tr.Path)
+		fmt.Printf("  expected: %s\n", tr.ExpectedLink)
+		fmt.Printf("  actual:   %s\n", tr.ActualLink)
+	case tr.Diff != "":
+		fmt.Print(tr.Diff)
+	default:
+		fmt.Printf("%s: no differences\n", tr.Path)
+	}
+}
+
+// findAgentFile returns the state entry for persona, or nil if it is not tracked.
+// Personas of the same name in different persona directories (a project's agents_dir shadowing
+// the user's) have an entry each: the one that wrote the canonical target is preferred.
+func findAgentFile(st *state.StatusState, persona string) *state.AgentFileState {
+	canonical := st.CanonicalTarget
+	if canonical == "" {
+		canonical = viper.GetString("target_file")
+	}
+	canonical = absPath(canonical)
+
+	var found *state.AgentFileState
+	for i := range st.AgentFiles {
+		af := &st.AgentFiles[i]
+		if af.Name != persona {
+			continue
+		}
+		for _, t := range af.Targets {
+			if absPath(t.Path) == canonical {
+				return af
+			}
+		}
+		if found == nil {
+			found = af
+		}
+	}
+	return found
+}
+
+// agentFileDirs returns the persona directories to resolve the persona of af with: the directory of
+// its agent file comes first, so that a persona shadowed by another of the same name still resolves
+// to the file it was applied from
+func agentFileDirs(af *state.AgentFileState, agentsDirs []string) []string {
+	if af == nil || af.Path == "" {
+		return agentsDirs
+	}
+	return append([]string{filepath.Dir(af.Path)}, agentsDirs...)
+}
+
+// absPath expands and absolutizes a path for comparison
+func absPath(path string) string {
+	abs, err := filepath.Abs(ops.ExpandPath(path))
+	if err != nil {
+		return ops.ExpandPath(path)
+	}
+	return abs
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+}
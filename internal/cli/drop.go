@@ -24,15 +24,18 @@ Example:
 	Run: func(cmd *cobra.Command, args []string) {
 		personaName := args[0]
 		targetFile, _ := cmd.Flags().GetString("target-file")
+		force, _ := cmd.Flags().GetBool("force")
+		agentsDirs := getAgentsDirs()
 
 		// Load state
 		st, err := state.LoadState()
 		if err != nil {
-			fmt.Printf("Error loading state: %v\n", err)
-			os.Exit(1)
+			fail("Error loading state: %v", err)
 		}
 		if st == nil {
-			fmt.Println("No state found.")
+			msg := "No state found."
+			textf("%s\n", msg)
+			emit(RemoveReport{Persona: personaName, Targets: []TargetReport{}, Message: msg})
 			return
 		}
 
@@ -47,11 +50,14 @@ Example:
 		}
 
 		if !foundPersona {
-			fmt.Printf("Persona '%s' not found in state.\n", personaName)
+			msg := fmt.Sprintf("Persona '%s' not found in state.", personaName)
+			textf("%s\n", msg)
+			emit(RemoveReport{Persona: personaName, Targets: []TargetReport{}, Message: msg})
 			return
 		}
 
-		targetsToRemove := []string{}
+		targetsToRemove := []state.TargetState{}
+		report := RemoveReport{Persona: personaName, Targets: []TargetReport{}}
 
 		if targetFile != "" {
 			// Remove specific target
@@ -65,24 +71,28 @@ Example:
 				tExpanded := ops.ExpandPath(t.Path)
 				if tExpanded == targetPath || t.Path == targetFile {
 					foundTarget = true
-					targetsToRemove = append(targetsToRemove, t.Path)
+					targetsToRemove = append(targetsToRemove, t)
 				} else {
 					newTargets = append(newTargets, t)
 				}
 			}
 
 			if !foundTarget {
-				fmt.Printf("Target '%s' not found for persona '%s'.\n", targetFile, personaName)
+				msg := fmt.Sprintf("Target '%s' not found for persona '%s'.", targetFile, personaName)
+				textf("%s\n", msg)
+				emit(RemoveReport{Persona: personaName, Targets: []TargetReport{}, Message: msg})
 				return
 			}
 
 			st.AgentFiles[personaIndex].Targets = newTargets
-			fmt.Printf("Dropping target '%s' from persona '%s'...\n", targetFile, personaName)
+			if !dryRun {
+				textf("Dropping target '%s' from persona '%s'...\n", targetFile, personaName)
+			}
 
 		} else {
 			// Remove ALL targets for this persona
 			for _, t := range st.AgentFiles[personaIndex].Targets {
-				targetsToRemove = append(targetsToRemove, t.Path)
+				targetsToRemove = append(targetsToRemove, t)
 			}
 
 			// Remove the persona entry itself?
@@ -95,12 +105,16 @@ Example:
 				}
 			}
 			st.AgentFiles = newAgentFiles
-			fmt.Printf("Dropping persona '%s' and all its targets...\n", personaName)
+			if !dryRun {
+				textf("Dropping persona '%s' and all its targets...\n", personaName)
+			}
 		}
 
 		// Perform physical removal
-		for _, tPath := range targetsToRemove {
-			exp := ops.ExpandPath(tPath)
+		plan := newPlan("drop", personaName)
+		journal := beginJournal()
+		for _, removed := range targetsToRemove {
+			exp := ops.ExpandPath(removed.Path)
 
 			// Safety Check: Is this target used by another persona?
 			isUsed := false
@@ -121,35 +135,87 @@ Example:
 				}
 			}
 
-			if isUsed {
-				fmt.Printf("State updated, but file retained: %s (Also used by '%s')\n", exp, usedBy)
+			if isUsed && dryRun {
+				plan.add(ops.PlanSkipShared, exp, fmt.Sprintf("Also used by '%s'", usedBy))
+			} else if isUsed {
+				textf("State updated, but file retained: %s (Also used by '%s')\n", exp, usedBy)
+				report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusRetained, Details: fmt.Sprintf("Also used by '%s'", usedBy)})
+				removeRendered(journal, exp, personaName)
 			} else {
 				// Check if directory
 				fi, err := os.Stat(exp)
 				if err == nil && fi.IsDir() {
-					fmt.Printf("Warning: target '%s' is a directory. Refusing to remove.\n", exp)
+					if dryRun {
+						plan.add(ops.PlanSkip, exp, "Is a directory")
+						continue
+					}
+					textf("Warning: target '%s' is a directory. Refusing to remove.\n", exp)
+					report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusSkipped, Details: "Is a directory"})
+					continue
+				}
+
+				// Only remove what we can prove we wrote
+				if !force {
+					if owned, reason := checkOwnership(absPath(exp), &removed, agentsDirs); !owned {
+						if dryRun {
+							plan.add(ops.PlanSkipForeign, exp, reason)
+							continue
+						}
+						textf("State updated, but file retained: %s (%s; use --force to remove anyway)\n", exp, reason)
+						report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusSkipped, Details: reason})
+						continue
+					}
+				}
+
+				if dryRun {
+					if _, err := os.Lstat(exp); err == nil {
+						plan.add(ops.PlanRemove, exp, "")
+					}
+					continue
+				}
+
+				// Keep what is removed so that undo can put it back
+				if err := journal.Record(exp); err != nil {
+					textf("Warning: Failed to journal %s, not removed: %v\n", exp, err)
+					report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusError, Details: err.Error()})
 					continue
 				}
 
 				if err := os.Remove(exp); err != nil {
 					if !os.IsNotExist(err) {
-						fmt.Printf("Warning: Failed to remove file %s: %v\n", exp, err)
+						textf("Warning: Failed to remove file %s: %v\n", exp, err)
+						report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusError, Details: err.Error()})
 					} else {
-						fmt.Printf("File %s already gone.\n", exp)
+						textf("File %s already gone.\n", exp)
+						report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusMissing})
+						removeRendered(journal, exp, "")
 					}
 				} else {
-					fmt.Printf("Removed: %s\n", exp)
+					textf("Removed: %s\n", exp)
+					report.Targets = append(report.Targets, TargetReport{Path: exp, Status: statusRemoved})
+					removeRendered(journal, exp, "")
 				}
 			}
 		}
 
+		if dryRun {
+			printPlan(plan)
+			return
+		}
+
 		// Save State
-		if err := state.WriteState(st); err != nil {
-			fmt.Printf("Error updating state: %v\n", err)
+		err = state.WriteState(st)
+		commitJournal(journal)
+		if err != nil {
+			report.Error = fmt.Sprintf("Error updating state: %v", err)
+			textf("%s\n", report.Error)
+			emit(report)
 			os.Exit(1)
 		}
 
-		fmt.Println("Drop complete.")
+		textf("Drop complete.\n")
+		offerRestore(removedPaths(report))
+		emit(report)
 	},
 }
 
@@ -159,4 +225,5 @@ func init() {
 	// Note: We use the same flag name "target-file" but locally bound to this command
 	// We do NOT bind it to viper global config for this command to avoid confusion.
 	dropCmd.Flags().String("target-file", "", "Specific target to drop")
+	dropCmd.Flags().Bool("force", false, "Remove targets even if they were not written by agent-smith")
 }
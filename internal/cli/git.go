@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/ops"
+)
+
+// gitHooks are the hooks that switch persona after the checked out branch changes
+var gitHooks = []string{"post-checkout", "post-merge"}
+
+// gitHookScript is installed as each hook. %[1]s is the quoted path of the agents binary,
+// %[2]s the hook name. A hook that was there before is kept with the .pre-agents suffix and runs first;
+// its exit status is the hook's exit status.
+const gitHookScript = `#!/bin/sh
+` + ops.GitHookMarker + `
+# A hook that was here before is kept as %[2]s.pre-agents and runs first.
+status=0
+if [ -x "$0.pre-agents" ]; then
+  "$0.pre-agents" "$@" || status=$?
+fi
+if [ -x %[1]s ]; then
+  %[1]s _git-hook %[2]s "$@" || true
+fi
+exit $status
+`
+
+// Statuses reported by install-hooks and uninstall-hooks
+const (
+	hookInstalled = "INSTALLED"
+	hookRestored  = "RESTORED"
+)
+
+// gitCmd represents the git command
+var gitCmd = &cobra.Command{
+	Use:   "git",
+	Short: "Switch persona from git hooks when the branch changes",
+	Long: `Install git hooks that switch persona when a branch is checked out or merged,
+using the branches mapping of the config:
+
+  branches:
+    - pattern: "docs/*"
+      persona: writer
+    - pattern: "release/*"
+      persona: reviewer`,
+}
+
+// gitInstallHooksCmd represents the git install-hooks command
+var gitInstallHooksCmd = &cobra.Command{
+	Use:   "install-hooks",
+	Short: "Install post-checkout and post-merge hooks in the current repository",
+	Long: `Install post-checkout and post-merge hooks in the git repository of the working directory.
+Hooks that are already there are kept and run before ours.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, hooksDir := currentGitRepo()
+
+		exe, err := os.Executable()
+		if err != nil {
+			fail("Error: cannot locate the agents binary: %v", err)
+		}
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+
+		if len(Cfg.Branches) == 0 {
+			warnf("Warning: no branches configured; the hooks will do nothing until you add some (see agents-config(5)).\n")
+		}
+
+		report := GitHooksReport{Repo: repo.Root, HooksDir: hooksDir, Hooks: []TargetReport{}}
+		failed := false
+		for _, name := range gitHooks {
+			path := filepath.Join(hooksDir, name)
+			chained, err := ops.InstallGitHook(path, fmt.Sprintf(gitHookScript, shellQuote(exe), name))
+			tr := TargetReport{Path: path, Status: hookInstalled}
+			switch {
+			case err != nil:
+				tr.Status = statusError
+				tr.Details = err.Error()
+				failed = true
+				textf("Error installing %s: %v\n", path, err)
+			case chained:
+				tr.Details = "Chained to " + filepath.Base(ops.ChainedGitHook(path))
+				textf("Installed %s (existing hook kept as %s)\n", path, filepath.Base(ops.ChainedGitHook(path)))
+			default:
+				textf("Installed %s\n", path)
+			}
+			report.Hooks = append(report.Hooks, tr)
+		}
+
+		if failed {
+			report.Error = "some hooks could not be installed"
+			emit(report)
+			os.Exit(1)
+		}
+		emit(report)
+	},
+}
+
+// gitUninstallHooksCmd represents the git uninstall-hooks command
+var gitUninstallHooksCmd = &cobra.Command{
+	Use:   "uninstall-hooks",
+	Short: "Remove the hooks installed by install-hooks",
+	Long: `Remove the post-checkout and post-merge hooks installed by install-hooks from the
+git repository of the working directory, putting back any hook they were chained to.
+Hooks that were not installed by agent-smith are left alone.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo, hooksDir := currentGitRepo()
+
+		report := GitHooksReport{Repo: repo.Root, HooksDir: hooksDir, Hooks: []TargetReport{}}
+		for _, name := range gitHooks {
+			path := filepath.Join(hooksDir, name)
+			removed, restored, err := ops.UninstallGitHook(path)
+			tr := TargetReport{Path: path}
+			switch {
+			case err != nil && removed:
+				tr.Status = statusError
+				tr.Details = err.Error()
+				textf("Removed %s but could not restore the previous hook: %v\n", path, err)
+			case err != nil:
+				tr.Status = statusSkipped
+				tr.Details = err.Error()
+				textf("Skipped %s: %v\n", path, err)
+			case restored:
+				tr.Status = hookRestored
+				tr.Details = "Restored the previous hook"
+				textf("Removed %s (previous hook restored)\n", path)
+			case removed:
+				tr.Status = statusRemoved
+				textf("Removed %s\n", path)
+			default:
+				tr.Status = statusMissing
+			}
+			report.Hooks = append(report.Hooks, tr)
+		}
+		emit(report)
+	},
+}
+
+// gitHookRunCmd is called by the installed git hooks
+var gitHookRunCmd = &cobra.Command{
+	Use:    "_git-hook <hook> [args...]",
+	Short:  "Switch persona for the checked out branch (called by the git hooks)",
+	Hidden: true,
+	Args:   cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// post-checkout <old> <new> <branch flag>: a flag of 0 means files were checked out, not a branch
+		if args[0] == "post-checkout" && len(args) >= 4 && args[3] == "0" {
+			return
+		}
+
+		cwd, err := os.Getwd()
+		if err != nil {
+			return
+		}
+		repo, err := ops.FindGitRepo(cwd)
+		if err != nil || repo == nil {
+			return
+		}
+		branch := repo.Branch()
+		rule, ok := ops.BranchPersona(Cfg.Branches, branch)
+		if !ok {
+			return
+		}
+
+		if activePersona() == rule.Persona {
+			return
+		}
+
+		// Runs in the middle of git's own output, so report the switch in one line
+		quietText = true
+		if _, err := activatePersona(rule.Persona, Cfg.Targets, nil, false); err != nil {
+			fmt.Fprintf(os.Stderr, "agents: branch %s: could not switch to %s: %v\n", branch, rule.Persona, err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "agents: branch %s -> %s\n", branch, rule.Persona)
+	},
+}
+
+// currentGitRepo finds the repository of the working directory and its hooks directory
+func currentGitRepo() (*ops.GitRepo, string) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		fail("Error: %v", err)
+	}
+	repo, err := ops.FindGitRepo(cwd)
+	if err != nil {
+		fail("Error: %v", err)
+	}
+	if repo == nil {
+		fail("Error: %s is not inside a git repository.", cwd)
+	}
+	return repo, repo.HooksDir()
+}
+
+func init() {
+	rootCmd.AddCommand(gitCmd)
+	rootCmd.AddCommand(gitHookRunCmd)
+	gitCmd.AddCommand(gitInstallHooksCmd)
+	gitCmd.AddCommand(gitUninstallHooksCmd)
+}
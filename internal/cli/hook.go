@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/state"
+)
+
+// Shell snippets printed by `agents hook`. %[1]s is the quoted path of the agents binary.
+// Each one only calls into agents when the working directory changed.
+var hookScripts = map[string]string{
+	"bash": `_agents_hook() {
+  if [[ "$PWD" != "${_AGENTS_LAST_PWD-}" ]]; then
+    _AGENTS_LAST_PWD="$PWD"
+    %[1]s _hook >/dev/null
+  fi
+}
+if [[ ";${PROMPT_COMMAND[*]-};" != *";_agents_hook;"* ]]; then
+  PROMPT_COMMAND="_agents_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	"zsh": `_agents_hook() {
+  %[1]s _hook >/dev/null
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _agents_hook
+_agents_hook
+`,
+	"fish": `function __agents_hook --on-variable PWD
+    %[1]s _hook >/dev/null
+end
+__agents_hook
+`,
+}
+
+// hookCmd represents the hook command
+var hookCmd = &cobra.Command{
+	Use:   "hook <bash|zsh|fish>",
+	Short: "Print a shell hook that syncs project pins on directory change",
+	Long: `Print a shell snippet that applies the pinned persona of a project (see agents sync)
+when you change into it. Add it to your shell startup file:
+
+  bash:  eval "$(agents hook bash)"     (~/.bashrc)
+  zsh:   eval "$(agents hook zsh)"      (~/.zshrc)
+  fish:  agents hook fish | source      (~/.config/fish/config.fish)
+
+The hook only syncs projects allowed with agents allow, and prints a notice in the others.
+It only runs when the directory changes, and does nothing while the project's pin is the
+persona the hook last synced it to and the project's targets are in place.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+	Run: func(cmd *cobra.Command, args []string) {
+		script, ok := hookScripts[args[0]]
+		if !ok {
+			fail("Error: unsupported shell %q (expected bash, zsh or fish).", args[0])
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			exe = "agents"
+		}
+		fmt.Printf(script, shellQuote(exe))
+	},
+}
+
+// hookRunCmd is called by the shell hook; it must stay fast and quiet
+var hookRunCmd = &cobra.Command{
+	Use:    "_hook",
+	Short:  "Sync the current project's pin (called by the shell hook)",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := revertExpired(); err != nil {
+			fmt.Fprintf(os.Stderr, "agents: %v\n", err)
+		}
+		if noProject {
+			return
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			return
+		}
+		pin, err := config.FindPin(cwd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "agents: %v\n", err)
+			return
+		}
+		if pin == nil {
+			return
+		}
+
+		// The pin comes with the repository: only projects the user allowed are synced
+		if ok, changed := hookAllowed(pin); !ok {
+			if changed {
+				fmt.Fprintf(os.Stderr, "agents: %s changed since it was allowed; review it and run 'agents allow' to sync it to %s\n", pin.Dir, pin.Persona)
+			} else {
+				fmt.Fprintf(os.Stderr, "agents: %s is pinned to %s; run 'agents allow' to let the hook sync it\n", pin.Dir, pin.Persona)
+			}
+			return
+		}
+
+		// Nothing to do if the hook already synced this project to the pinned persona and its targets are still there
+		cache := loadHookCache()
+		if cache[pin.Dir] == pin.Persona && pinTargetsInPlace(pin) {
+			return
+		}
+
+		if _, err := syncPin(pin, getAgentsDirs(), false, false); err != nil {
+			fmt.Fprintf(os.Stderr, "agents: could not sync %s to %s: %v\n", pin.Dir, pin.Persona, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "agents: %s -> %s\n", pin.Dir, pin.Persona)
+
+		cache[pin.Dir] = pin.Persona
+		saveHookCache(cache)
+	},
+}
+
+// hookAllowed reports whether the hook may sync pin (see agents allow), and if not, whether
+// that is because its configuration changed since it was allowed
+func hookAllowed(pin *config.Pin) (ok, changed bool) {
+	allowed, err := state.LoadAllowed()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agents: %v\n", err)
+		return false, false
+	}
+	want, found := allowed[pin.Dir]
+	if !found {
+		return false, false
+	}
+	hash, err := pin.Hash()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agents: %v\n", err)
+		return false, false
+	}
+	return hash == want, hash != want
+}
+
+// pinTargetsInPlace is the hook's cheap check that the targets synced for pin were not removed or
+// relinked since: each is tracked under the pinned persona, exists, and links point where they were left.
+// Contents are not read.
+func pinTargetsInPlace(pin *config.Pin) bool {
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		return false
+	}
+	for _, t := range projectTargets(pin) {
+		path := absPath(t.Path)
+		af, tracked := findTrackedTarget(st, pin.Persona, path)
+		if af == nil || af.Name != pin.Persona {
+			return false
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return false
+		}
+		if tracked.LinkDest == "" {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return false
+		}
+		if dest, err := os.Readlink(path); err != nil || filepath.Clean(dest) != filepath.Clean(tracked.LinkDest) {
+			return false
+		}
+	}
+	return true
+}
+
+// forgetHookSync drops what the hook remembers about the project in the working directory, so the
+// hook checks its pin again after a command changed targets
+func forgetHookSync() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	pin, err := config.FindPin(cwd)
+	if err != nil || pin == nil {
+		return
+	}
+	cache := loadHookCache()
+	if _, ok := cache[pin.Dir]; !ok {
+		return
+	}
+	delete(cache, pin.Dir)
+	saveHookCache(cache)
+}
+
+// hookCachePath is where the hook remembers the persona each project was synced to
+func hookCachePath() (string, error) {
+	cacheHome, err := config.GetCacheHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheHome, "agent-smith", "hook.yaml"), nil
+}
+
+func loadHookCache() map[string]string {
+	cache := make(map[string]string)
+	path, err := hookCachePath()
+	if err != nil {
+		return cache
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		yaml.Unmarshal(data, &cache)
+	}
+	if cache == nil {
+		cache = make(map[string]string)
+	}
+	return cache
+}
+
+func saveHookCache(cache map[string]string) {
+	path, err := hookCachePath()
+	if err != nil {
+		return
+	}
+	data, err := yaml.Marshal(cache)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	os.WriteFile(path, data, 0644)
+}
+
+// shellQuote quotes s for POSIX shells and fish
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func init() {
+	rootCmd.AddCommand(hookCmd)
+	rootCmd.AddCommand(hookRunCmd)
+}
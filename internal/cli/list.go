@@ -2,11 +2,11 @@ package cli
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
+
+	"agent-smith/internal/ops"
 )
 
 // listCmd represents the list command
@@ -14,61 +14,106 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available personas",
 	Long: `List all available personas found in the configured agents directory.
-Personas are defined in files named AGENTS.<persona>.md`,
+Personas are defined in files named AGENTS.<persona>.md
+
+Example:
+  agents list --tag go --long`,
 	Run: func(cmd *cobra.Command, args []string) {
-		agentsDirs := viper.GetStringSlice("agents_dir")
-		if len(agentsDirs) == 0 {
-			// Fallback to string if slice is empty (e.g. env var set as string)
-			if s := viper.GetString("agents_dir"); s != "" {
-				agentsDirs = []string{s}
+		agentsDirs := getAgentsDirs()
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		long, _ := cmd.Flags().GetBool("long")
+
+		report := ListReport{Personas: []PersonaReport{}}
+
+		for _, entry := range ops.ListPersonas(agentsDirs) {
+			p, loadErr := ops.LoadPersona(entry.Name, agentsDirs)
+
+			// Filter by tags (all given tags must be present)
+			if len(tags) > 0 {
+				if loadErr != nil {
+					continue
+				}
+				matches := true
+				for _, tag := range tags {
+					if !p.Meta.HasTag(tag) {
+						matches = false
+						break
+					}
+				}
+				if !matches {
+					continue
+				}
+			}
+
+			pr := PersonaReport{
+				Name: entry.Name,
+				Dir:  entry.Dir,
+				Path: entry.Path,
+			}
+			if loadErr != nil {
+				pr.Error = loadErr.Error()
+			} else {
+				pr.Description = p.Meta.Description
+				pr.Tags = p.Meta.Tags
+				pr.Author = p.Meta.Author
+				pr.Version = p.Meta.Version
+				pr.Targets = p.Meta.Targets
+				if len(p.Chain) > 1 {
+					pr.Extends = p.Chain[1:]
+				}
 			}
+			report.Personas = append(report.Personas, pr)
+		}
+
+		if structuredOutput() {
+			emit(report)
+			return
 		}
 
 		fmt.Println("Available Personas:")
-		foundAny := false
-
-		seen := make(map[string]bool)
-
-		for _, agentsDir := range agentsDirs {
-			// Ensure agents directory exists (only if it looks like a default/user one we should create?
-			// Actually previous logic created it. Let's create it if it doesn't exist to be friendly,
-			// or just skip if missing. The prompt asked for creation: "The program should create any required directories"
-			// But I successfully updated that logic before revert... wait.
-			// The user REVERTED the create logic because of NixOS read-only.
-			// So I should NOT create directories here. Just skip if missing.
-
-			files, err := os.ReadDir(agentsDir)
-			if err != nil {
-				if !os.IsNotExist(err) {
-					// Only print error if it's not permission denied/not found?
-					// fmt.Printf("Error reading %s: %v\n", agentsDir, err)
-				}
+		for _, pr := range report.Personas {
+			if pr.Error != "" {
+				fmt.Printf("  - %s (%s) (error: %s)\n", pr.Name, pr.Dir, pr.Error)
 				continue
 			}
 
-			for _, file := range files {
-				if file.IsDir() {
-					continue
-				}
-				name := file.Name()
-				if strings.HasPrefix(name, "AGENTS.") && strings.HasSuffix(name, ".md") && name != "AGENTS.md" {
-					// Extract persona name: AGENTS.coder.md -> coder
-					persona := strings.TrimSuffix(strings.TrimPrefix(name, "AGENTS."), ".md")
-					if !seen[persona] {
-						fmt.Printf("  - %s (%s)\n", persona, agentsDir)
-						seen[persona] = true
-						foundAny = true
-					}
-				}
+			if !long {
+				fmt.Printf("  - %s (%s)%s\n", pr.Name, pr.Dir, describeChain(pr.Extends))
+				continue
 			}
+
+			fmt.Printf("  - %s (%s)\n", pr.Name, pr.Dir)
+			printField("Description", pr.Description)
+			printField("Tags", strings.Join(pr.Tags, ", "))
+			printField("Author", pr.Author)
+			printField("Version", pr.Version)
+			printField("Extends", strings.Join(pr.Extends, " -> "))
+			printField("Targets", strings.Join(pr.Targets, ", "))
 		}
 
-		if !foundAny {
+		if len(report.Personas) == 0 {
 			fmt.Println("  (No personas found)")
 		}
 	},
 }
 
+// describeChain renders the inheritance chain of a persona for display, if it has one
+func describeChain(extends []string) string {
+	if len(extends) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (extends: %s)", strings.Join(extends, " -> "))
+}
+
+func printField(label, value string) {
+	if value != "" {
+		fmt.Printf("      %s: %s\n", label, value)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
+
+	listCmd.Flags().StringSlice("tag", []string{}, "only list personas with this tag (can be specified multiple times)")
+	listCmd.Flags().BoolP("long", "l", false, "show persona metadata")
 }
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/state"
+)
+
+// logCmd represents the log command
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the history of persona switches",
+	Long: `Show the personas activated by use, auto, push, pop and the git hooks, most recent first.
+The history is kept in $XDG_STATE_HOME/agent-smith/history.jsonl.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+		long, _ := cmd.Flags().GetBool("long")
+
+		history, err := state.LoadHistory()
+		if err != nil {
+			fail("Error: failed to read history: %v", err)
+		}
+
+		report := LogReport{Entries: []LogEntryReport{}}
+		var entries []state.HistoryEntry
+		for i := len(history) - 1; i >= 0; i-- {
+			if limit > 0 && len(entries) == limit {
+				break
+			}
+			e := history[i]
+			entries = append(entries, e)
+			targets := e.Targets
+			if targets == nil {
+				targets = []string{}
+			}
+			report.Entries = append(report.Entries, LogEntryReport{
+				Time:      e.Time.Format(time.RFC3339),
+				Persona:   e.Persona,
+				AgentFile: e.AgentFile,
+				Targets:   targets,
+				Host:      e.Host,
+				Command:   e.Command,
+			})
+		}
+
+		if structuredOutput() {
+			emit(report)
+			return
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("No persona switches recorded.")
+			return
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %-12s %-16s %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Persona, e.Host, e.Command)
+			if long {
+				fmt.Printf("    Agent File: %s\n", e.AgentFile)
+				for _, t := range e.Targets {
+					fmt.Printf("    Target: %s\n", t)
+				}
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+
+	logCmd.Flags().IntP("limit", "n", 20, "Number of entries to show (0 for all)")
+	logCmd.Flags().BoolP("long", "l", false, "Show the agent file and targets of each entry")
+}
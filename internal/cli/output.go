@@ -0,0 +1,406 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+)
+
+// Output formats accepted by --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// outputFormat is set by the global --output flag
+var outputFormat = outputText
+
+// quietText discards human-readable progress; set by watch, which logs events instead
+var quietText bool
+
+// The types below form the documented machine-readable schema (see agents(1), OUTPUT FORMATS).
+// Field names are part of the interface; only add fields, never rename or remove them.
+
+// PersonaReport describes an available persona (list)
+type PersonaReport struct {
+	Name        string   `json:"name" yaml:"name"`
+	Dir         string   `json:"dir" yaml:"dir"`
+	Path        string   `json:"path" yaml:"path"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Author      string   `json:"author,omitempty" yaml:"author,omitempty"`
+	Version     string   `json:"version,omitempty" yaml:"version,omitempty"`
+	Extends     []string `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Targets     []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Error       string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ListReport is the result of `agents list`
+type ListReport struct {
+	Personas []PersonaReport `json:"personas" yaml:"personas"`
+}
+
+// TargetReport describes a single target (status, use, reconcile, unuse, drop)
+type TargetReport struct {
+	Path    string            `json:"path" yaml:"path"`
+	Mode    config.TargetMode `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Status  string            `json:"status" yaml:"status"`
+	Details string            `json:"details,omitempty" yaml:"details,omitempty"`
+	// Persona is the variant the target gets instead of the active persona, if any
+	Persona string `json:"persona,omitempty" yaml:"persona,omitempty"`
+}
+
+// StatusPersonaReport describes a persona tracked in state (status)
+type StatusPersonaReport struct {
+	Name    string         `json:"name" yaml:"name"`
+	Path    string         `json:"path,omitempty" yaml:"path,omitempty"`
+	Active  bool           `json:"active" yaml:"active"`
+	Tracked bool           `json:"tracked" yaml:"tracked"`
+	Chain   []string       `json:"chain,omitempty" yaml:"chain,omitempty"`
+	Targets []TargetReport `json:"targets" yaml:"targets"`
+}
+
+// StatusReport is the result of `agents status`
+type StatusReport struct {
+	ActivePersona   string                `json:"active_persona" yaml:"active_persona"`
+	CanonicalTarget string                `json:"canonical_target" yaml:"canonical_target"`
+	ProjectConfig   string                `json:"project_config,omitempty" yaml:"project_config,omitempty"`
+	Pin             *PinReport            `json:"pin,omitempty" yaml:"pin,omitempty"`
+	Stack           []StackReport         `json:"stack,omitempty" yaml:"stack,omitempty"`
+	Personas        []StatusPersonaReport `json:"personas" yaml:"personas"`
+}
+
+// StackReport is a persona saved by `agents push` (status)
+type StackReport struct {
+	Persona   string   `json:"persona" yaml:"persona"`
+	AgentFile string   `json:"agent_file,omitempty" yaml:"agent_file,omitempty"`
+	Targets   []string `json:"targets" yaml:"targets"`
+	PushedAt  string   `json:"pushed_at" yaml:"pushed_at"`
+	Over      string   `json:"over,omitempty" yaml:"over,omitempty"`
+	Expires   string   `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// PinReport describes whether the project's targets match its pinned persona (status)
+type PinReport struct {
+	Persona string         `json:"persona" yaml:"persona"`
+	File    string         `json:"file" yaml:"file"`
+	Project string         `json:"project" yaml:"project"`
+	InSync  bool           `json:"in_sync" yaml:"in_sync"`
+	Targets []TargetReport `json:"targets" yaml:"targets"`
+}
+
+// AllowReport is the result of allow and deny
+type AllowReport struct {
+	Project string `json:"project" yaml:"project"`
+	Persona string `json:"persona" yaml:"persona"`
+	Allowed bool   `json:"allowed" yaml:"allowed"`
+}
+
+// ApplyReport is the result of commands that apply a persona (use, reconcile)
+type ApplyReport struct {
+	Persona   string         `json:"persona" yaml:"persona"`
+	AgentFile string         `json:"agent_file,omitempty" yaml:"agent_file,omitempty"`
+	Targets   []TargetReport `json:"targets" yaml:"targets"`
+	Backups   []BackupReport `json:"backups,omitempty" yaml:"backups,omitempty"`
+	Message   string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Error     string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// RemoveReport is the result of commands that remove targets (unuse, drop)
+type RemoveReport struct {
+	Persona string         `json:"persona,omitempty" yaml:"persona,omitempty"`
+	Targets []TargetReport `json:"targets" yaml:"targets"`
+	Message string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Error   string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// DiffTargetReport describes how a target differs from its persona (diff)
+type DiffTargetReport struct {
+	Path         string            `json:"path" yaml:"path"`
+	Mode         config.TargetMode `json:"mode" yaml:"mode"`
+	Status       string            `json:"status" yaml:"status"`
+	ExpectedLink string            `json:"expected_link,omitempty" yaml:"expected_link,omitempty"`
+	ActualLink   string            `json:"actual_link,omitempty" yaml:"actual_link,omitempty"`
+	Diff         string            `json:"diff,omitempty" yaml:"diff,omitempty"`
+	Details      string            `json:"details,omitempty" yaml:"details,omitempty"`
+	Persona      string            `json:"persona,omitempty" yaml:"persona,omitempty"`
+}
+
+// DiffReport is the result of `agents diff`
+type DiffReport struct {
+	Persona string             `json:"persona" yaml:"persona"`
+	Targets []DiffTargetReport `json:"targets" yaml:"targets"`
+	Message string             `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// CaptureReport is the result of `agents capture`
+type CaptureReport struct {
+	Persona   string `json:"persona" yaml:"persona"`
+	AgentFile string `json:"agent_file" yaml:"agent_file"`
+	Target    string `json:"target" yaml:"target"`
+	Diff      string `json:"diff,omitempty" yaml:"diff,omitempty"`
+	Captured  bool   `json:"captured" yaml:"captured"`
+	Message   string `json:"message,omitempty" yaml:"message,omitempty"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// BackupReport describes an unmanaged file moved aside before a target was written
+type BackupReport struct {
+	Path      string `json:"path" yaml:"path"`
+	Backup    string `json:"backup" yaml:"backup"`
+	CreatedAt string `json:"created_at" yaml:"created_at"`
+}
+
+// RestoreReport is the result of `agents restore`
+type RestoreReport struct {
+	Backups  []BackupReport `json:"backups" yaml:"backups"`
+	Restored []BackupReport `json:"restored,omitempty" yaml:"restored,omitempty"`
+}
+
+// PlanActionReport is a single change a dry run would make
+type PlanActionReport struct {
+	Action  string `json:"action" yaml:"action"`
+	Path    string `json:"path" yaml:"path"`
+	Details string `json:"details,omitempty" yaml:"details,omitempty"`
+}
+
+// PlanReport is the result of use, unuse, drop and reconcile with --dry-run
+type PlanReport struct {
+	Command string             `json:"command" yaml:"command"`
+	Persona string             `json:"persona,omitempty" yaml:"persona,omitempty"`
+	DryRun  bool               `json:"dry_run" yaml:"dry_run"`
+	Actions []PlanActionReport `json:"actions" yaml:"actions"`
+	Message string             `json:"message,omitempty" yaml:"message,omitempty"`
+	Error   string             `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// RuleConditionReport is the outcome of one condition of a rule (auto)
+type RuleConditionReport struct {
+	Condition string `json:"condition" yaml:"condition"`
+	Pattern   string `json:"pattern" yaml:"pattern"`
+	Value     string `json:"value" yaml:"value"`
+	Matched   bool   `json:"matched" yaml:"matched"`
+	Error     string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// RuleReport is the outcome of a rule (auto)
+type RuleReport struct {
+	Rule       string                `json:"rule" yaml:"rule"`
+	Persona    string                `json:"persona" yaml:"persona"`
+	Matched    bool                  `json:"matched" yaml:"matched"`
+	Conditions []RuleConditionReport `json:"conditions" yaml:"conditions"`
+}
+
+// AutoReport is the result of `agents auto` when nothing was switched, and of `agents auto --explain`
+type AutoReport struct {
+	Dir     string       `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Branch  string       `json:"branch,omitempty" yaml:"branch,omitempty"`
+	Host    string       `json:"host,omitempty" yaml:"host,omitempty"`
+	Time    string       `json:"time,omitempty" yaml:"time,omitempty"`
+	Active  string       `json:"active,omitempty" yaml:"active,omitempty"`
+	Rule    string       `json:"rule,omitempty" yaml:"rule,omitempty"`
+	Persona string       `json:"persona,omitempty" yaml:"persona,omitempty"`
+	Rules   []RuleReport `json:"rules" yaml:"rules"`
+	Message string       `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// GitHooksReport is the result of `agents git install-hooks` and `agents git uninstall-hooks`
+type GitHooksReport struct {
+	Repo     string         `json:"repo" yaml:"repo"`
+	HooksDir string         `json:"hooks_dir" yaml:"hooks_dir"`
+	Hooks    []TargetReport `json:"hooks" yaml:"hooks"`
+	Error    string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ServiceFileReport is a unit or property list written by `agents service`
+type ServiceFileReport struct {
+	Path    string `json:"path" yaml:"path"`
+	Status  string `json:"status" yaml:"status"`
+	Details string `json:"details,omitempty" yaml:"details,omitempty"`
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// ServiceReport is the result of `agents service install`, `uninstall` and `status`
+type ServiceReport struct {
+	Platform string              `json:"platform" yaml:"platform"`
+	Mode     string              `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Unit     string              `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Active   string              `json:"active,omitempty" yaml:"active,omitempty"`
+	Files    []ServiceFileReport `json:"files" yaml:"files"`
+	Error    string              `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// LogEntryReport is a persona activation from the history log
+type LogEntryReport struct {
+	Time      string   `json:"time" yaml:"time"`
+	Persona   string   `json:"persona" yaml:"persona"`
+	AgentFile string   `json:"agent_file,omitempty" yaml:"agent_file,omitempty"`
+	Targets   []string `json:"targets" yaml:"targets"`
+	Host      string   `json:"host,omitempty" yaml:"host,omitempty"`
+	Command   string   `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+// LogReport is the result of `agents log`, most recent entry first
+type LogReport struct {
+	Entries []LogEntryReport `json:"entries" yaml:"entries"`
+}
+
+// UndoReport is the result of `agents undo`
+type UndoReport struct {
+	Command string         `json:"command,omitempty" yaml:"command,omitempty"`
+	Time    string         `json:"time,omitempty" yaml:"time,omitempty"`
+	Targets []TargetReport `json:"targets" yaml:"targets"`
+	Message string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Error   string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// JournalEntryReport is a command that can be undone (undo --list)
+type JournalEntryReport struct {
+	ID      string   `json:"id" yaml:"id"`
+	Time    string   `json:"time" yaml:"time"`
+	Command string   `json:"command" yaml:"command"`
+	Files   []string `json:"files" yaml:"files"`
+}
+
+// JournalReport is the result of `agents undo --list`, most recent first
+type JournalReport struct {
+	Entries []JournalEntryReport `json:"entries" yaml:"entries"`
+}
+
+// WatchEvent is a log line of `agents watch`
+type WatchEvent struct {
+	Time    string         `json:"time" yaml:"time"`
+	Level   string         `json:"level" yaml:"level"`
+	Event   string         `json:"event" yaml:"event"`
+	Persona string         `json:"persona,omitempty" yaml:"persona,omitempty"`
+	Paths   []string       `json:"paths,omitempty" yaml:"paths,omitempty"`
+	Targets []TargetReport `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Message string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Error   string         `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// VersionReport is the result of `agents version`
+type VersionReport struct {
+	Version string `json:"version" yaml:"version"`
+}
+
+// ErrorReport is printed when a command fails before producing a result
+type ErrorReport struct {
+	Error string `json:"error" yaml:"error"`
+}
+
+// Target statuses used in reports
+const (
+	statusOK       = "OK"
+	statusMissing  = "MISSING"
+	statusDrift    = "DRIFT"
+	statusError    = "ERROR"
+	statusModified = "MODIFIED" // copy edited locally since apply
+	statusStale    = "STALE"    // source persona changed since apply
+	statusConflict = "CONFLICT" // both of the above
+	statusRemoved  = "REMOVED"
+	statusRetained = "RETAINED"
+	statusSkipped  = "SKIPPED"
+
+	statusRolledBack = "ROLLED_BACK"
+)
+
+// validateOutputFormat checks the --output flag
+func validateOutputFormat() error {
+	switch outputFormat {
+	case outputText, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("invalid output format %q (expected text, json or yaml)", outputFormat)
+}
+
+// structuredOutput reports whether a machine-readable format was requested
+func structuredOutput() bool {
+	return outputFormat == outputJSON || outputFormat == outputYAML
+}
+
+// textOut is where human-readable progress goes; it is discarded for structured output
+func textOut() io.Writer {
+	if structuredOutput() || quietText {
+		return io.Discard
+	}
+	return os.Stdout
+}
+
+// textf prints human-readable output. It is silent when structured output is selected.
+func textf(format string, a ...any) {
+	fmt.Fprintf(textOut(), format, a...)
+}
+
+// warnf prints a warning. Structured output sends it to stderr to keep stdout parseable.
+func warnf(format string, a ...any) {
+	if structuredOutput() {
+		fmt.Fprintf(os.Stderr, format, a...)
+		return
+	}
+	fmt.Printf(format, a...)
+}
+
+// emit prints a report in the selected structured format. It does nothing for text output.
+func emit(report any) {
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	case outputYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		enc.Encode(report)
+		enc.Close()
+	}
+}
+
+// fail reports an error and exits with status 1.
+// Text output prints the message; structured output emits an ErrorReport.
+func fail(format string, a ...any) {
+	msg := fmt.Sprintf(format, a...)
+	if structuredOutput() {
+		emit(ErrorReport{Error: msg})
+	} else {
+		fmt.Println(msg)
+	}
+	os.Exit(1)
+}
+
+// applyReport converts the result of ops.ApplyPersonaWithOptions into a report
+func applyReport(persona string, result *ops.ApplyResult, err error) ApplyReport {
+	report := ApplyReport{
+		Persona:   persona,
+		AgentFile: result.AgentPath,
+		Targets:   []TargetReport{},
+	}
+	for _, t := range result.Targets {
+		tr := TargetReport{Path: t.Path, Mode: t.Target.Mode, Status: statusOK, Persona: t.Variant}
+		if tr.Mode == "" {
+			tr.Mode = config.TargetModeLink
+		}
+		switch {
+		case t.Err != nil:
+			tr.Status = statusError
+			tr.Details = t.Err.Error()
+		case t.RolledBack:
+			tr.Status = statusRolledBack
+			tr.Details = "Restored after another target failed"
+		case t.Unchanged:
+			tr.Details = "Unchanged"
+		}
+		report.Targets = append(report.Targets, tr)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return report
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// checkOwnership reports whether the file at path is provably one agent-smith wrote.
+// t is the tracked state of the target (nil if untracked). When the file is not ours a reason is returned.
+// Missing files are considered owned; there is nothing to protect.
+func checkOwnership(path string, t *state.TargetState, agentsDirs []string) (bool, string) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return true, ""
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		// Links we wrote point where we recorded; older state only has the persona file name
+		if t != nil && t.LinkDest != "" {
+			dest, err := os.Readlink(path)
+			if err != nil {
+				return false, err.Error()
+			}
+			if !filepath.IsAbs(dest) {
+				dest = filepath.Join(filepath.Dir(path), dest)
+			}
+			if filepath.Clean(dest) == filepath.Clean(t.LinkDest) {
+				return true, ""
+			}
+			return false, "Link points elsewhere than agent-smith left it"
+		}
+		if inferPersona(path) != "" {
+			return true, ""
+		}
+		return false, "Link does not point to a persona"
+	}
+
+	if info.IsDir() {
+		return false, "Is a directory"
+	}
+	if t == nil {
+		return false, "Not tracked by agent-smith"
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err.Error()
+	}
+	if t.Hash != "" && ops.HashContent(content) == t.Hash {
+		return true, ""
+	}
+	if ops.HasMarker(content) {
+		return true, ""
+	}
+	// State written before hashes were recorded: accept an exact copy of a persona
+	if t.Hash == "" && matchesPersona(path, agentsDirs) {
+		return true, ""
+	}
+	return false, "Content is not what agent-smith wrote"
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+)
+
+// dryRun is set by the global --dry-run flag
+var dryRun bool
+
+// newPlan starts the dry-run report of command
+func newPlan(command, persona string) *PlanReport {
+	return &PlanReport{Command: command, Persona: persona, DryRun: true, Actions: []PlanActionReport{}}
+}
+
+// add records a change the command would make
+func (r *PlanReport) add(action, path, details string) {
+	r.Actions = append(r.Actions, PlanActionReport{Action: action, Path: path, Details: details})
+}
+
+// addActions records the changes planned by ops
+func (r *PlanReport) addActions(actions []ops.PlanAction) {
+	for _, a := range actions {
+		r.add(a.Action, a.Path, a.Details)
+	}
+}
+
+// finishApplyPlan adds the backups and target changes applying persona would make, prints the plan and exits
+func finishApplyPlan(r *PlanReport, persona string, agentsDirs []string, targets []config.TargetConfig, vars map[string]string) {
+	backups := unmanagedTargets(targets, agentsDirs)
+	for _, path := range backups {
+		r.add(ops.PlanBackup, path, "Not created by agent-smith")
+	}
+	actions, err := ops.PlanApply(persona, agentsDirs, targets, ops.ApplyOptions{Vars: vars})
+	for i, a := range actions {
+		// Backed up files are moved away first, so their targets are created fresh
+		if slices.Contains(backups, absPath(a.Path)) {
+			switch a.Action {
+			case ops.PlanOverwriteCopy:
+				actions[i] = ops.PlanAction{Action: ops.PlanCreateCopy, Path: a.Path}
+			case ops.PlanReplaceLink:
+				actions[i] = ops.PlanAction{Action: ops.PlanCreateLink, Path: a.Path, Details: "-> " + a.Dest, Dest: a.Dest}
+			}
+		}
+	}
+	r.addActions(actions)
+	if err != nil {
+		r.Error = err.Error()
+		printPlan(r)
+		os.Exit(1)
+	}
+	printPlan(r)
+	os.Exit(0)
+}
+
+// printPlan shows the plan; nothing has been changed at this point
+func printPlan(r *PlanReport) {
+	if structuredOutput() {
+		emit(r)
+		return
+	}
+
+	title := r.Command
+	if r.Persona != "" {
+		title += " " + r.Persona
+	}
+	fmt.Printf("Dry run of '%s' (nothing was changed):\n", title)
+	for _, a := range r.Actions {
+		if a.Details != "" {
+			fmt.Printf("  %-15s %s (%s)\n", a.Action, a.Path, a.Details)
+		} else {
+			fmt.Printf("  %-15s %s\n", a.Action, a.Path)
+		}
+	}
+	if len(r.Actions) == 0 {
+		fmt.Println("  (no changes)")
+	}
+	if r.Message != "" {
+		fmt.Println(r.Message)
+	}
+	if r.Error != "" {
+		fmt.Printf("Error: %s\n", r.Error)
+	}
+}
@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// pushCmd represents the push command
+var pushCmd = &cobra.Command{
+	Use:   "push <persona>",
+	Short: "Switch to a persona temporarily, remembering the current one",
+	Long: `Save the active persona, with the targets and variables it was applied with, on the
+persona stack and switch to another one. agents pop switches back.
+
+Example:
+  agents push reviewer
+  agents pop`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		persona := args[0]
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+
+		duration, _ := cmd.Flags().GetDuration("for")
+		pushPersona("push", persona, Cfg.Targets, nil, bestEffort, expiry(duration))
+	},
+}
+
+// expiry returns when an activation --for d ends, or the zero time if d is 0
+func expiry(d time.Duration) time.Time {
+	if d < 0 {
+		fail("Error: --for must be positive.")
+	}
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(d).UTC()
+}
+
+// pushPersona saves the active persona on the stack and switches to persona (push, use --for).
+// If expires is set the saved persona comes back by itself after that time (see revertExpired).
+func pushPersona(command, persona string, targets []config.TargetConfig, setVars map[string]string, bestEffort bool, expires time.Time) {
+	current := activePersona()
+	if current == "" {
+		fail("Error: no active persona to return to; use 'agents use %s' instead.", persona)
+	}
+
+	entry := state.StackEntry{Persona: current, Targets: state.TargetStates(Cfg.Targets), PushedAt: time.Now().UTC(), Over: persona, Expires: expires}
+	if st, err := state.LoadState(); err == nil && st != nil {
+		if af := findAgentFile(st, current); af != nil {
+			entry.AgentFile = af.Path
+			entry.Targets = af.Targets
+			entry.Vars = af.Vars
+		}
+	}
+
+	// The switch is reported once the stack is saved, so that a failure is part of the one report
+	report := applySwitch(command, persona, targets, setVars, bestEffort)
+	entry.OverTargets = state.TargetStates(targets)
+
+	if err := state.PushStack(entry); err != nil {
+		report.Error = fmt.Sprintf("switched to '%s' but failed to save '%s' on the stack: %v", persona, current, err)
+		textf("Error: %s\n", report.Error)
+		emit(report)
+		os.Exit(1)
+	}
+	printSwitched(report)
+	if !expires.IsZero() {
+		textf("'%s' is active until %s, then '%s' comes back.\n", persona, expires.Local().Format("2006-01-02 15:04"), current)
+		return
+	}
+	textf("Pushed '%s'; 'agents pop' returns to it.\n", current)
+}
+
+// revertExpired switches back to the saved persona once a time-boxed activation (use --for) is over.
+// It is called by status, reconcile and the shell hook, so the activation ends even without agents watch.
+// Callers warn about the returned error and carry on; the entry stays on the stack to be retried.
+func revertExpired() error {
+	if dryRun {
+		return nil
+	}
+	for {
+		top, err := state.PeekStack()
+		if err != nil || !top.Expired(time.Now()) {
+			return nil
+		}
+
+		// The persona was changed by hand since: that choice wins over the expiry
+		if active := activePersona(); active != top.Over {
+			if _, err := state.PopStack(); err != nil {
+				return err
+			}
+			warnf("Note: '%s' expired, but the active persona is now '%s'; not switching back to '%s'.\n", top.Over, orNone(active), top.Persona)
+			continue
+		}
+
+		var targets []config.TargetConfig
+		for _, t := range top.Targets {
+			targets = append(targets, t.TargetConfig())
+		}
+		if _, err := activatePersona(top.Persona, targets, top.Vars, false); err != nil {
+			return fmt.Errorf("'%s' expired but switching back to '%s' failed: %w", top.Over, top.Persona, err)
+		}
+		dropPushed(top)
+		if _, err := state.PopStack(); err != nil {
+			return err
+		}
+		textf("'%s' expired at %s; switched back to '%s'.\n", top.Over, top.Expires.Local().Format("2006-01-02 15:04"), top.Persona)
+	}
+}
+
+// dropPushed undoes what the persona pushed over entry did to the targets entry does not have, once
+// entry is active again: they are removed with their rendered copies, a file the push backed up is put back, and the pushed
+// persona is no longer tracked. Targets that changed since the push are kept.
+func dropPushed(entry state.StackEntry) {
+	if entry.Over == "" || entry.Over == entry.Persona {
+		return
+	}
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		return
+	}
+
+	saved := make(map[string]bool)
+	for _, t := range entry.Targets {
+		saved[absPath(t.Path)] = true
+	}
+	agentsDirs := getAgentsDirs()
+
+	var kept []state.AgentFileState
+	for _, af := range st.AgentFiles {
+		if af.Name != entry.Over {
+			kept = append(kept, af)
+			continue
+		}
+		for _, t := range af.Targets {
+			path := absPath(t.Path)
+			if saved[path] {
+				// Back on the saved persona: the pushed persona's rendered copy is no longer linked
+				removeRendered(nil, path, entry.Over)
+				continue
+			}
+			if !pushedTarget(entry, path) {
+				continue
+			}
+			if owned, reason := checkOwnership(path, &t, agentsDirs); !owned {
+				warnf("Warning: keeping %s: %s\n", path, reason)
+				continue
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				warnf("Warning: failed to remove %s: %v\n", path, err)
+				continue
+			}
+			textf("Removed: %s\n", path)
+			removeRendered(nil, path, "")
+			restorePushBackup(st, path, entry.PushedAt)
+		}
+	}
+	st.AgentFiles = kept
+
+	if err := state.WriteState(st); err != nil {
+		warnf("Warning: Failed to update state file: %v\n", err)
+	}
+}
+
+// pushedTarget reports whether path is one of the targets the pushed persona was applied to
+func pushedTarget(entry state.StackEntry, path string) bool {
+	for _, t := range entry.OverTargets {
+		if absPath(t.Path) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// restorePushBackup moves back the file a push backed up from path, if there is one
+func restorePushBackup(st *state.StatusState, path string, pushedAt time.Time) {
+	for i := len(st.Backups) - 1; i >= 0; i-- {
+		b := st.Backups[i]
+		if absPath(b.Path) != path || b.CreatedAt.Before(pushedAt) {
+			continue
+		}
+		if err := ops.RestoreFile(b.Backup, path); err != nil {
+			warnf("Warning: %v\n", err)
+			return
+		}
+		st.Backups = append(st.Backups[:i], st.Backups[i+1:]...)
+		textf("Restored: %s\n", path)
+		return
+	}
+}
+
+// popCmd represents the pop command
+var popCmd = &cobra.Command{
+	Use:   "pop",
+	Short: "Switch back to the persona saved by push",
+	Long: `Switch back to the persona on top of the persona stack, reapplying it to the targets
+and with the variables it had when it was pushed, and remove it from the stack.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+
+		top, err := state.PeekStack()
+		if errors.Is(err, state.ErrStackEmpty) {
+			fail("Error: the persona stack is empty (see agents push).")
+		}
+
+		var targets []config.TargetConfig
+		for _, t := range top.Targets {
+			targets = append(targets, t.TargetConfig())
+		}
+		textf("Returning to persona '%s' (pushed %s)\n", top.Persona, top.PushedAt.Local().Format("2006-01-02 15:04"))
+		switchPersona("pop", top.Persona, targets, top.Vars, bestEffort)
+		dropPushed(top)
+
+		if _, err := state.PopStack(); err != nil {
+			fail("Error: %v", err)
+		}
+	},
+}
+
+// stackReports describes the persona stack for status, top first
+func stackReports(stack []state.StackEntry) []StackReport {
+	var reports []StackReport
+	for i := len(stack) - 1; i >= 0; i-- {
+		e := stack[i]
+		r := StackReport{Persona: e.Persona, AgentFile: e.AgentFile, Targets: []string{}, PushedAt: e.PushedAt.Format(time.RFC3339), Over: e.Over}
+		if !e.Expires.IsZero() {
+			r.Expires = e.Expires.Format(time.RFC3339)
+		}
+		for _, t := range e.Targets {
+			r.Targets = append(r.Targets, t.Path)
+		}
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+func printStack(stack []StackReport) {
+	fmt.Println("Persona stack (top first, 'agents pop' returns to the top):")
+	for _, r := range stack {
+		pushed, err := time.Parse(time.RFC3339, r.PushedAt)
+		if err != nil {
+			fmt.Printf("  %s\n", r.Persona)
+			continue
+		}
+		line := fmt.Sprintf("  %s (pushed %s", r.Persona, pushed.Local().Format("2006-01-02 15:04"))
+		if expires, err := time.Parse(time.RFC3339, r.Expires); err == nil {
+			line += fmt.Sprintf(", back when '%s' expires at %s", r.Over, expires.Local().Format("2006-01-02 15:04"))
+		}
+		fmt.Println(line + ")")
+	}
+	fmt.Println()
+}
+
+func init() {
+	rootCmd.AddCommand(pushCmd)
+	rootCmd.AddCommand(popCmd)
+
+	pushCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+	pushCmd.Flags().Duration("for", 0, "Switch back automatically after this long (e.g. 30m, 2h)")
+	popCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+}
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -12,77 +13,254 @@ import (
 	"agent-smith/internal/state"
 )
 
+// Policies for --on-conflict
+const (
+	conflictAbort     = "abort"
+	conflictOverwrite = "overwrite"
+	conflictCapture   = "capture"
+)
+
 // reconcileCmd represents the reconcile command
 var reconcileCmd = &cobra.Command{
 	Use:   "reconcile",
 	Short: "Reapply the active persona to all targets",
-	Long:  `Reapply the currently active persona to all configured targets, fixing any drift or missing files.`,
+	Long: `Reapply the currently active persona to all configured targets, fixing any drift or missing files.
+
+Copy targets edited locally since they were applied are handled by --on-conflict:
+  overwrite  replace the local edits with the persona, with a warning (default)
+  abort      stop without changing anything
+  capture    write the edited target back into the persona first (see agents capture)
+
+With --stale-only only the copies whose source persona changed since they were
+applied (STALE in agents status) are rewritten; everything else is left alone.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		st, err := state.LoadState()
-		if err != nil || st == nil || len(st.AgentFiles) == 0 {
-			fmt.Println("No active personas (agent files) found. Cannot reconcile.")
-			return
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		switch onConflict {
+		case conflictAbort, conflictOverwrite, conflictCapture:
+		default:
+			fail("Error: invalid --on-conflict %q (expected abort, overwrite or capture).", onConflict)
 		}
 
-		agentsDirs := viper.GetStringSlice("agents_dir")
-		if len(agentsDirs) == 0 {
-			if s := viper.GetString("agents_dir"); s != "" {
-				agentsDirs = []string{s}
-			}
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+		staleOnly, _ := cmd.Flags().GetBool("stale-only")
+		report, err := reconcileActive(onConflict, bestEffort, staleOnly)
+		emit(report)
+		if err != nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// reconcileActive reapplies the active persona to its targets (reconcile, watch).
+// With staleOnly only the stale targets are rewritten.
+// Progress goes to the text output; the error is already reported there when it is returned.
+func reconcileActive(onConflict string, bestEffort, staleOnly bool) (ApplyReport, error) {
+	// End a time-boxed persona (use --for) that ran out before reapplying
+	if err := revertExpired(); err != nil {
+		warnf("Warning: %v\n", err)
+	}
+
+	st, err := state.LoadState()
+	if err != nil || st == nil || len(st.AgentFiles) == 0 {
+		msg := "No active personas (agent files) found. Cannot reconcile."
+		textf("%s\n", msg)
+		return ApplyReport{Targets: []TargetReport{}, Message: msg}, nil
+	}
+
+	agentsDirs := getAgentsDirs()
+
+	// Determine Canonical Target and Active Persona
+	canonical := st.CanonicalTarget
+	if canonical == "" {
+		canonical = viper.GetString("target_file")
+	}
+
+	activePersona := inferPersona(canonical)
+	if activePersona == "" {
+		msg := "No active persona found to reconcile."
+		textf("%s\n", msg)
+		return ApplyReport{Targets: []TargetReport{}, Message: msg}, nil
+	}
+
+	textf("Reconciling active persona: %s\n", activePersona)
+
+	// Find the active persona in state to get its tracked targets
+	// This ensures we respect dynamic targets (CLI flags) that were saved.
+	var targetsToApply []config.TargetConfig
+	var trackedTargets []state.TargetState
+	var setVars map[string]string
+	foundInState := false
+
+	if af := findAgentFile(st, activePersona); af != nil {
+		trackedTargets = af.Targets
+		for _, t := range af.Targets {
+			targetsToApply = append(targetsToApply, t.TargetConfig())
 		}
+		setVars = af.Vars
+		foundInState = true
+		// Reapply the persona file the targets were written from, even if another one shadows it now
+		agentsDirs = agentFileDirs(af, agentsDirs)
+	}
+
+	if !foundInState {
+		// Fallback to Config targets if not tracked in state yet (legacy or manual switch)
+		// But note: if it WAS in state but had 0 targets, targetsToApply is empty, which is correct.
+		// But we only set foundInState if we found the entry.
+		// If not found, use config.
+		textf("Active persona not found in state, using defaults.\n")
+		targetsToApply = Cfg.Targets
+	}
+
+	// failed reports an error that happened before anything was applied
+	failed := func(format string, a ...any) (ApplyReport, error) {
+		err := fmt.Errorf(format, a...)
+		textf("Error: %v\n", err)
+		return ApplyReport{Persona: activePersona, Targets: []TargetReport{}, Error: err.Error()}, err
+	}
 
-		// Determine Canonical Target and Active Persona
-		canonical := st.CanonicalTarget
-		if canonical == "" {
-			canonical = viper.GetString("target_file")
+	// Handle local edits according to --on-conflict before anything is overwritten
+	source := loadPersonaSource(activePersona, agentsDirs)
+	var edited []TargetReport
+	var editedStates []state.TargetState
+	var staleTargets []config.TargetConfig
+	for _, t := range trackedTargets {
+		tr := checkTargetStatus(t, activePersona, source)
+		switch tr.Status {
+		case statusModified, statusConflict:
+			if staleOnly {
+				// Local edits are never refreshed here; they are left for capture or a full reconcile
+				textf("Skipping edited target: %s (%s)\n", tr.Path, tr.Details)
+				continue
+			}
+			edited = append(edited, tr)
+			editedStates = append(editedStates, t)
+		case statusStale:
+			staleTargets = append(staleTargets, t.TargetConfig())
+			if !dryRun {
+				textf("Refreshing stale target: %s\n", tr.Path)
+			}
 		}
+	}
 
-		activePersona := inferPersona(canonical)
-		if activePersona == "" {
-			fmt.Println("No active persona found to reconcile.")
-			return
+	if staleOnly {
+		if len(staleTargets) == 0 {
+			msg := "No stale targets to refresh."
+			textf("%s\n", msg)
+			return ApplyReport{Persona: activePersona, Targets: []TargetReport{}, Message: msg}, nil
 		}
+		targetsToApply = staleTargets
+	}
+
+	var plan *PlanReport
+	if dryRun {
+		plan = newPlan("reconcile", activePersona)
+	}
 
-		fmt.Printf("Reconciling active persona: %s\n", activePersona)
-
-		// Find the active persona in state to get its tracked targets
-		// This ensures we respect dynamic targets (CLI flags) that were saved.
-		var targetsToApply []config.TargetConfig
-		foundInState := false
-
-		for _, af := range st.AgentFiles {
-			if af.Name == activePersona {
-				for _, t := range af.Targets {
-					targetsToApply = append(targetsToApply, config.TargetConfig{
-						Path: t.Path,
-						Mode: t.Mode,
-					})
-				}
-				foundInState = true
+	if len(edited) > 0 {
+		switch onConflict {
+		case conflictAbort:
+			for _, tr := range edited {
+				textf("Target edited locally: %s\n", tr.Path)
+			}
+			msg := "local edits would be overwritten; run 'agents capture <target>' or use --on-conflict=overwrite|capture"
+			if plan != nil {
+				plan.Error = msg
+				printPlan(plan)
+				os.Exit(1)
+			}
+			textf("Aborting: %s\n", msg)
+			return ApplyReport{Persona: activePersona, Targets: edited, Error: msg}, errors.New(msg)
+		case conflictOverwrite:
+			for _, tr := range edited {
+				warnf("Warning: %s was edited locally; overwriting.\n", tr.Path)
+			}
+		case conflictCapture:
+			if len(edited) > 1 {
+				return failed("%d targets were edited locally; capture one with 'agents capture <target>'", len(edited))
+			}
+			if edited[0].Status == statusConflict {
+				return failed("%s was edited locally and the persona changed since apply; capture it with 'agents capture --force' after reviewing 'agents diff'", edited[0].Path)
+			}
+			cp, err := planCapture(activePersona, editedStates[0], agentsDirs, ops.MergeVars(Cfg.Vars, setVars), false)
+			if err != nil {
+				return failed("%v", err)
+			}
+			if plan != nil {
+				plan.add(ops.PlanCapture, cp.AgentPath, "From "+cp.TargetPath)
 				break
 			}
+			textf("%s", cp.Diff)
+			if err := cp.commit(canonical); err != nil {
+				return failed("failed to capture %s: %v", cp.TargetPath, err)
+			}
+			textf("Captured %s into %s\n", cp.TargetPath, cp.AgentPath)
 		}
+	}
 
-		if !foundInState {
-			// Fallback to Config targets if not tracked in state yet (legacy or manual switch)
-			// But note: if it WAS in state but had 0 targets, targetsToApply is empty, which is correct.
-			// But we only set foundInState if we found the entry.
-			// If not found, use config.
-			fmt.Println("Active persona not found in state, using defaults.")
-			targetsToApply = Cfg.Targets
-		}
+	if plan != nil {
+		finishApplyPlan(plan, activePersona, agentsDirs, targetsToApply, ops.MergeVars(Cfg.Vars, setVars))
+	}
 
-		// Reapply active persona to targets
-		_, err = ops.ApplyPersona(activePersona, agentsDirs, targetsToApply)
-		if err != nil {
-			fmt.Printf("Failed to reconcile: %v\n", err)
-			os.Exit(1)
+	backups, err := backupUnmanaged(targetsToApply, agentsDirs)
+	if err != nil {
+		return failed("%v (refusing to overwrite)", err)
+	}
+
+	// Reapply active persona to targets
+	result, err := ops.ApplyPersonaWithOptions(activePersona, agentsDirs, targetsToApply, ops.ApplyOptions{
+		Vars:       ops.MergeVars(Cfg.Vars, setVars),
+		Out:        textOut(),
+		BestEffort: bestEffort,
+	})
+	report := applyReport(activePersona, result, err)
+	report.Backups = backups
+	if err != nil {
+		if !bestEffort {
+			undoBackups(backups)
+			report.Backups = nil
 		}
+		textf("Failed to reconcile: %v\n", err)
+		return report, err
+	}
 
-		fmt.Println("Reconciliation complete.")
-	},
+	// Record the new content hashes
+	applied := targetStates(result)
+	if staleOnly {
+		applied = mergeTargetStates(trackedTargets, applied)
+	}
+	if err := state.RecordAgentFile(canonical, state.AgentFileState{
+		Name:    activePersona,
+		Path:    result.AgentPath,
+		Targets: applied,
+		Vars:    setVars,
+	}); err != nil {
+		warnf("Warning: Failed to save status state: %v\n", err)
+	}
+
+	textf("Reconciliation complete.\n")
+	return report, nil
+}
+
+// mergeTargetStates replaces the tracked targets that were reapplied, keeping the others and their order
+func mergeTargetStates(tracked, applied []state.TargetState) []state.TargetState {
+	byPath := make(map[string]state.TargetState, len(applied))
+	for _, t := range applied {
+		byPath[absPath(ops.ExpandPath(t.Path))] = t
+	}
+	merged := make([]state.TargetState, 0, len(tracked))
+	for _, t := range tracked {
+		if a, ok := byPath[absPath(ops.ExpandPath(t.Path))]; ok {
+			t = a
+		}
+		merged = append(merged, t)
+	}
+	return merged
 }
 
 func init() {
 	rootCmd.AddCommand(reconcileCmd)
+
+	reconcileCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+	reconcileCmd.Flags().Bool("stale-only", false, "Only rewrite copies whose source persona changed since they were applied")
+	reconcileCmd.Flags().String("on-conflict", conflictOverwrite, "How to handle locally edited targets: overwrite, abort or capture")
 }
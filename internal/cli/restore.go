@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore [target]",
+	Short: "Bring back a file that was backed up before a target replaced it",
+	Long: `Files found at a target path that agents did not create are moved to a backup
+store before the target is written. Without an argument the backups are listed;
+with a target path the most recent backup of that path is moved back and the
+target is no longer tracked.
+
+Example:
+  agents restore
+  agents restore ~/.claude/CLAUDE.md`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		st, err := state.LoadState()
+		if err != nil || st == nil {
+			st = &state.StatusState{}
+		}
+
+		if len(args) == 0 {
+			report := RestoreReport{Backups: []BackupReport{}}
+			for _, b := range st.Backups {
+				report.Backups = append(report.Backups, backupReport(b))
+			}
+			if structuredOutput() {
+				emit(report)
+				return
+			}
+			if len(st.Backups) == 0 {
+				fmt.Println("No backups.")
+				return
+			}
+			fmt.Println("Backups:")
+			for _, b := range st.Backups {
+				fmt.Printf("  %s (%s)\n    %s\n", b.Path, b.CreatedAt.Local().Format(time.DateTime), b.Backup)
+			}
+			return
+		}
+
+		want := absPath(args[0])
+		idx := -1
+		for i, b := range st.Backups {
+			if absPath(b.Path) == want {
+				idx = i
+			}
+		}
+		if idx == -1 {
+			fail("No backup found for '%s'.", args[0])
+		}
+		backup := st.Backups[idx]
+
+		// Only our own link or copy may be replaced by the restored file
+		if _, err := os.Lstat(want); err == nil {
+			if !isManaged(st, want, getAgentsDirs()) {
+				fail("Error: %s exists and was not created by agents; move it away first.", want)
+			}
+			if err := os.Remove(want); err != nil {
+				fail("Error removing %s: %v", want, err)
+			}
+			textf("Removed: %s\n", want)
+		}
+
+		if err := ops.RestoreFile(backup.Backup, want); err != nil {
+			fail("Error: %v", err)
+		}
+
+		// Forget the backup and stop tracking the target so reconcile leaves the file alone
+		st.Backups = append(st.Backups[:idx], st.Backups[idx+1:]...)
+		untrackTarget(st, want)
+		if err := state.WriteState(st); err != nil {
+			warnf("Warning: Failed to update state file: %v\n", err)
+		}
+
+		textf("Restored: %s\n", want)
+		report := RestoreReport{Backups: []BackupReport{}, Restored: []BackupReport{backupReport(backup)}}
+		for _, b := range st.Backups {
+			report.Backups = append(report.Backups, backupReport(b))
+		}
+		emit(report)
+	},
+}
+
+func backupReport(b state.BackupState) BackupReport {
+	return BackupReport{Path: b.Path, Backup: b.Backup, CreatedAt: b.CreatedAt.Format(time.RFC3339)}
+}
+
+// unmanagedTargets returns the target paths holding files agents did not create or that changed since.
+// A file is left alone when it is what agents wrote there or matches a persona.
+func unmanagedTargets(targets []config.TargetConfig, agentsDirs []string) []string {
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		st = &state.StatusState{}
+	}
+
+	var paths []string
+	for _, t := range targets {
+		targetPath := absPath(t.Path)
+		if _, err := os.Lstat(targetPath); err != nil {
+			continue
+		}
+		if isManaged(st, targetPath, agentsDirs) || matchesPersona(targetPath, agentsDirs) || slices.Contains(paths, targetPath) {
+			continue
+		}
+		paths = append(paths, targetPath)
+	}
+	return paths
+}
+
+// backupUnmanaged moves files agents did not create out of the way of targets
+func backupUnmanaged(targets []config.TargetConfig, agentsDirs []string) ([]BackupReport, error) {
+	var backups []BackupReport
+	for _, targetPath := range unmanagedTargets(targets, agentsDirs) {
+		root, err := state.BackupDir()
+		if err != nil {
+			return backups, err
+		}
+		backupPath, err := ops.BackupFile(targetPath, root)
+		if err != nil {
+			return backups, err
+		}
+
+		b := state.BackupState{Path: targetPath, Backup: backupPath, CreatedAt: time.Now()}
+		if err := state.RecordBackup(b); err != nil {
+			return backups, fmt.Errorf("backed up %s to %s but failed to record it: %w", targetPath, backupPath, err)
+		}
+		textf("Backed up unmanaged file: %s -> %s\n", targetPath, backupPath)
+		backups = append(backups, backupReport(b))
+	}
+	return backups, nil
+}
+
+// undoBackups moves files backed up by backupUnmanaged back into place and forgets the backups
+func undoBackups(backups []BackupReport) {
+	if len(backups) == 0 {
+		return
+	}
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		st = &state.StatusState{}
+	}
+	for _, b := range backups {
+		if err := ops.RestoreFile(b.Backup, b.Path); err != nil {
+			warnf("Warning: %v (backup kept at %s)\n", err, b.Backup)
+			continue
+		}
+		textf("Restored: %s\n", b.Path)
+		var kept []state.BackupState
+		for _, sb := range st.Backups {
+			if sb.Backup != b.Backup {
+				kept = append(kept, sb)
+			}
+		}
+		st.Backups = kept
+	}
+	if err := state.WriteState(st); err != nil {
+		warnf("Warning: Failed to update state file: %v\n", err)
+	}
+}
+
+// isManaged reports whether path still holds what agents wrote there: the recorded link or content
+// of a tracked target, or a link to a persona. Tracked targets edited or replaced since are not managed.
+func isManaged(st *state.StatusState, path string, agentsDirs []string) bool {
+	tracked := false
+	for _, af := range st.AgentFiles {
+		for i := range af.Targets {
+			if absPath(af.Targets[i].Path) != path {
+				continue
+			}
+			tracked = true
+			if owned, _ := checkOwnership(path, &af.Targets[i], agentsDirs); owned {
+				return true
+			}
+		}
+	}
+	if tracked {
+		return false
+	}
+	owned, _ := checkOwnership(path, nil, agentsDirs)
+	return owned
+}
+
+// matchesPersona reports whether the file at path has the content of one of the personas
+func matchesPersona(path string, agentsDirs []string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, entry := range ops.ListPersonas(agentsDirs) {
+		raw, err := os.ReadFile(entry.Path)
+		if err != nil {
+			continue
+		}
+		if bytes.Equal(content, raw) {
+			return true
+		}
+		if body, err := ops.PersonaBody(entry.Path); err == nil && bytes.Equal(content, body) {
+			return true
+		}
+	}
+	return false
+}
+
+// untrackTarget removes path from the targets of every tracked persona
+func untrackTarget(st *state.StatusState, path string) {
+	for i := range st.AgentFiles {
+		var kept []state.TargetState
+		for _, t := range st.AgentFiles[i].Targets {
+			if absPath(t.Path) != path {
+				kept = append(kept, t)
+			}
+		}
+		st.AgentFiles[i].Targets = kept
+	}
+}
+
+// removedPaths returns the targets a RemoveReport lists as removed
+func removedPaths(report RemoveReport) []string {
+	var paths []string
+	for _, t := range report.Targets {
+		if t.Status == statusRemoved {
+			paths = append(paths, t.Path)
+		}
+	}
+	return paths
+}
+
+// offerRestore tells the user about backups of targets that were just removed
+func offerRestore(removed []string) {
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		return
+	}
+	for _, path := range removed {
+		for _, b := range st.Backups {
+			if absPath(b.Path) == absPath(path) {
+				textf("A backup of %s exists; run 'agents restore %s' to bring it back.\n", path, path)
+				break
+			}
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
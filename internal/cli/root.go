@@ -11,14 +11,21 @@ import (
 
 	"agent-smith/internal/config"
 	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
 )
 
 var (
 	// Used for flags.
 	cfgFile string
 
+	// Set by --no-project
+	noProject bool
+
 	// Cfg stores the global configuration
 	Cfg config.Config
+
+	// ProjectCfg is the .agents.yaml layered on top of Cfg (nil if none was found)
+	ProjectCfg *config.ProjectConfig
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -28,6 +35,9 @@ var rootCmd = &cobra.Command{
 	Long: `agents - Agent Smith persona manager
 
 Manage AGENTS.md symlinks to switch between different agent personas.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return validateOutputFormat()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -47,6 +57,9 @@ func init() {
 	// We previously had agents-dir etc. Let's keep them reachable via flags if user wants overrides.
 	rootCmd.PersistentFlags().StringSlice("agents-dir", []string{}, "directory containing agent personas (can be specified multiple times)")
 	rootCmd.PersistentFlags().String("target-file", "", "path to the AGENTS.md symlink")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputText, "output format: text, json or yaml")
+	rootCmd.PersistentFlags().BoolVar(&noProject, "no-project", false, "ignore "+config.ProjectConfigName+" files in the working directory and its parents")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what use, unuse, drop and reconcile would change without touching any file")
 
 	// Bind agents_dir to viper
 	viper.BindPFlag("agents_dir", rootCmd.PersistentFlags().Lookup("agents-dir"))
@@ -58,6 +71,18 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
+// getAgentsDirs returns the persona search path
+func getAgentsDirs() []string {
+	agentsDirs := viper.GetStringSlice("agents_dir")
+	if len(agentsDirs) == 0 {
+		// Fallback to string if slice is empty (e.g. env var set as string)
+		if s := viper.GetString("agents_dir"); s != "" {
+			agentsDirs = []string{s}
+		}
+	}
+	return agentsDirs
+}
+
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" {
@@ -93,6 +118,8 @@ func initConfig() {
 	defaultAgentsDirs = append(defaultAgentsDirs, "/usr/share/agent-smith/personas")
 
 	viper.SetDefault("agents_dir", defaultAgentsDirs)
+	viper.SetDefault("journal_retention", state.DefaultJournalRetention)
+	viper.SetDefault("watch_interval", defaultWatchInterval)
 
 	cHome, err := config.GetConfigHome()
 	if err == nil {
@@ -121,22 +148,80 @@ func initConfig() {
 	// Backward Compatibility:
 	// If 'target_file' is set but not in 'targets', add it as a managed target (LINK mode).
 	// This ensures legacy users still get their main symlink managed/monitored.
-	if Cfg.TargetFile != "" {
-		found := false
-		absTarget, _ := filepath.Abs(ops.ExpandPath(Cfg.TargetFile))
-
-		for _, t := range Cfg.Targets {
-			tAbs, _ := filepath.Abs(ops.ExpandPath(t.Path))
-			if tAbs == absTarget {
-				found = true
-				break
-			}
+	if Cfg.TargetFile != "" && !hasTarget(Cfg.Targets, Cfg.TargetFile) {
+		Cfg.Targets = append(Cfg.Targets, config.TargetConfig{
+			Path: Cfg.TargetFile,
+			Mode: config.TargetModeLink,
+		})
+	}
+
+	// Project configuration is layered on top of the user config
+	if !noProject {
+		loadProjectConfig()
+	}
+
+	// The canonical target defines the active persona, so it never gets a variant
+	canonical := absPath(viper.GetString("target_file"))
+	for i, t := range Cfg.Targets {
+		if len(t.Variants) > 0 && absPath(t.Path) == canonical {
+			warnf("Warning: ignoring variants of the canonical target %s; it always links to the active persona.\n", t.Path)
+			Cfg.Targets[i].Variants = nil
 		}
-		if !found {
-			Cfg.Targets = append(Cfg.Targets, config.TargetConfig{
-				Path: Cfg.TargetFile,
-				Mode: config.TargetModeLink,
-			})
+	}
+}
+
+// loadProjectConfig finds the nearest .agents.yaml and merges it into Cfg.
+// Precedence: --agents-dir and AGENTS_* environment variables, then the project file, then the user config.
+func loadProjectConfig() {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	path, err := config.FindProjectConfig(cwd)
+	if err != nil || path == "" {
+		return
+	}
+
+	pc, err := config.LoadProjectConfig(path)
+	if err != nil {
+		fmt.Printf("Error parsing project config: %v\n", err)
+		os.Exit(1)
+	}
+	ProjectCfg = pc
+
+	// Project persona directories are searched before the user's
+	if len(pc.AgentsDir) > 0 && !rootCmd.PersistentFlags().Changed("agents-dir") && os.Getenv("AGENTS_AGENTS_DIR") == "" {
+		dirs := append(append([]string{}, pc.AgentsDir...), getAgentsDirs()...)
+		viper.Set("agents_dir", dirs)
+		Cfg.AgentsDir = dirs
+	}
+
+	// Project targets are added to the user's
+	for _, t := range pc.Targets {
+		if !hasTarget(Cfg.Targets, t.Path) {
+			Cfg.Targets = append(Cfg.Targets, t)
+		}
+	}
+
+	// Project variables override the user's
+	if len(pc.Vars) > 0 {
+		Cfg.Vars = ops.MergeVars(Cfg.Vars, pc.Vars)
+	}
+
+	// Project branch rules are tried before the user's
+	if len(pc.Branches) > 0 {
+		Cfg.Branches = append(append([]config.BranchRule{}, pc.Branches...), Cfg.Branches...)
+	}
+}
+
+// hasTarget reports whether targets already contains path
+func hasTarget(targets []config.TargetConfig, path string) bool {
+	abs, _ := filepath.Abs(ops.ExpandPath(path))
+	for _, t := range targets {
+		tAbs, _ := filepath.Abs(ops.ExpandPath(t.Path))
+		if tAbs == abs {
+			return true
 		}
 	}
+	return false
 }
@@ -0,0 +1,522 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+)
+
+// Service managers supported by --platform
+const (
+	platformSystemd = "systemd"
+	platformLaunchd = "launchd"
+)
+
+// defaultServiceInterval is the period of the timer mode when --interval is not set
+const defaultServiceInterval = 15 * time.Minute
+
+// serviceEnv are the variables copied into the service environment when set, with the
+// AGENTS_* overrides, so the service resolves the same config, personas and state as the
+// shell that installed it
+var serviceEnv = []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_STATE_HOME", "XDG_CACHE_HOME"}
+
+// Statuses reported by service
+const (
+	serviceInstalled = "INSTALLED"
+	serviceOutdated  = "OUTDATED"
+	servicePrinted   = "PRINTED"
+)
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run watch or reconcile in the background as a systemd user service or launch agent",
+	Long: `Install a background service that keeps the active persona applied:
+
+  watch   a long running service running agents watch (default)
+  timer   agents reconcile every --interval (systemd .timer, launchd StartInterval)
+  path    agents reconcile when the persona directories change (systemd .path,
+          launchd WatchPaths)
+
+systemd units are written to $XDG_CONFIG_HOME/systemd/user, the launch agent to
+~/Library/LaunchAgents. The service runs the agents binary that installed it, with the
+config file in use and the XDG directories of the current environment.`,
+}
+
+// serviceInstallCmd represents the service install command
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Write the service files and start the service",
+	Long: `Write the service files for --mode and enable and start the service with systemctl
+or launchctl. Files of another mode installed before are removed. With --print the
+files are printed instead of written, and nothing is started.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			fail("Error: --dry-run is not supported by service; use --print.")
+		}
+		platform := servicePlatform(cmd)
+		mode, _ := cmd.Flags().GetString("mode")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if mode == ops.ServiceTimer && interval == 0 {
+			interval = defaultServiceInterval
+		}
+		if interval < 0 {
+			fail("Error: --interval must be positive.")
+		}
+
+		spec, err := serviceSpec(mode, interval)
+		if err != nil {
+			fail("Error: %v", err)
+		}
+		files, err := serviceFiles(platform, spec)
+		if err != nil {
+			fail("Error: %v", err)
+		}
+
+		report := ServiceReport{Platform: platform, Mode: mode, Unit: serviceUnit(platform, mode), Files: []ServiceFileReport{}}
+
+		if print, _ := cmd.Flags().GetBool("print"); print {
+			for _, f := range files {
+				report.Files = append(report.Files, ServiceFileReport{Path: f.Path, Status: servicePrinted, Content: f.Content})
+				textf("# %s\n%s\n", f.Path, f.Content)
+			}
+			emit(report)
+			return
+		}
+
+		filesOnly, _ := cmd.Flags().GetBool("files-only")
+
+		// A service installed in another mode is replaced
+		keep := make(map[string]bool, len(files))
+		for _, f := range files {
+			keep[f.Path] = true
+		}
+		var stale []string
+		for _, path := range installedServiceFiles(platform) {
+			if !keep[path] {
+				stale = append(stale, path)
+			}
+		}
+		if len(stale) > 0 && !filesOnly {
+			stopService(platform, installedServiceMode(platform))
+		}
+		for _, path := range stale {
+			if err := os.Remove(path); err != nil {
+				report.Files = append(report.Files, ServiceFileReport{Path: path, Status: statusError, Details: err.Error()})
+				textf("Error removing %s: %v\n", path, err)
+				continue
+			}
+			report.Files = append(report.Files, ServiceFileReport{Path: path, Status: statusRemoved})
+			textf("Removed %s\n", path)
+		}
+
+		failed := false
+		for _, f := range files {
+			fr := ServiceFileReport{Path: f.Path, Status: serviceInstalled}
+			if err := writeServiceFile(f); err != nil {
+				fr.Status = statusError
+				fr.Details = err.Error()
+				failed = true
+				textf("Error writing %s: %v\n", f.Path, err)
+			} else {
+				textf("Installed %s\n", f.Path)
+			}
+			report.Files = append(report.Files, fr)
+		}
+		if failed {
+			report.Error = "some service files could not be written"
+			emit(report)
+			os.Exit(1)
+		}
+
+		if filesOnly {
+			var manual []string
+			for _, args := range startCommands(platform, mode) {
+				manual = append(manual, strings.Join(args, " "))
+			}
+			textf("Not started (--files-only); run: %s\n", strings.Join(manual, " && "))
+		} else if err := runServiceCommands(startCommands(platform, mode)); err != nil {
+			warnf("Warning: the service files are installed but the service could not be started: %v\n", err)
+		} else {
+			textf("Started %s\n", report.Unit)
+		}
+		report.Active = serviceActive(platform, mode)
+		emit(report)
+	},
+}
+
+// serviceUninstallCmd represents the service uninstall command
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop the service and remove its files",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			fail("Error: --dry-run is not supported by service.")
+		}
+		platform := servicePlatform(cmd)
+		mode := installedServiceMode(platform)
+		report := ServiceReport{Platform: platform, Mode: mode, Files: []ServiceFileReport{}}
+
+		installed := installedServiceFiles(platform)
+		if len(installed) == 0 {
+			textf("No service installed.\n")
+			emit(report)
+			return
+		}
+		report.Unit = serviceUnit(platform, mode)
+
+		filesOnly, _ := cmd.Flags().GetBool("files-only")
+		if !filesOnly {
+			stopService(platform, mode)
+		}
+
+		failed := false
+		for _, path := range installed {
+			fr := ServiceFileReport{Path: path, Status: statusRemoved}
+			if err := os.Remove(path); err != nil {
+				fr.Status = statusError
+				fr.Details = err.Error()
+				failed = true
+				textf("Error removing %s: %v\n", path, err)
+			} else {
+				textf("Removed %s\n", path)
+			}
+			report.Files = append(report.Files, fr)
+		}
+		if platform == platformSystemd && !filesOnly {
+			runServiceCommand([]string{"systemctl", "--user", "daemon-reload"})
+		}
+		if failed {
+			report.Error = "some service files could not be removed"
+			emit(report)
+			os.Exit(1)
+		}
+		emit(report)
+	},
+}
+
+// serviceStatusCmd represents the service status command
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the service is installed, up to date and running",
+	Long: `Show the installed service files and whether the service manager reports the service
+as running. A file is OUTDATED when it does not run the current agents binary with the
+config file in use; run agents service install again to update it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		platform := servicePlatform(cmd)
+		mode := installedServiceMode(platform)
+		report := ServiceReport{Platform: platform, Mode: mode, Files: []ServiceFileReport{}}
+
+		installed := installedServiceFiles(platform)
+		if len(installed) > 0 {
+			report.Unit = serviceUnit(platform, mode)
+			report.Active = serviceActive(platform, mode)
+		}
+
+		spec, specErr := serviceSpec(mode, 0)
+		for _, path := range installed {
+			fr := ServiceFileReport{Path: path, Status: serviceInstalled}
+			data, err := os.ReadFile(path)
+			switch {
+			case err != nil:
+				fr.Status = statusError
+				fr.Details = err.Error()
+			case specErr == nil && !strings.Contains(string(data), spec.Executable):
+				fr.Status = serviceOutdated
+				fr.Details = "Runs another agents binary"
+			case specErr == nil && spec.ConfigFile != "" && !strings.Contains(string(data), spec.ConfigFile):
+				fr.Status = serviceOutdated
+				fr.Details = "Uses another config file"
+			}
+			report.Files = append(report.Files, fr)
+		}
+
+		if structuredOutput() {
+			emit(report)
+			return
+		}
+		if len(installed) == 0 {
+			fmt.Printf("No service installed (%s).\n", platform)
+			return
+		}
+		fmt.Printf("Service: %s (%s, mode %s)\n", report.Unit, platform, mode)
+		if report.Active != "" {
+			fmt.Printf("  State: %s\n", report.Active)
+		}
+		fmt.Println("  Files:")
+		for _, fr := range report.Files {
+			printTargetReport(TargetReport{Path: fr.Path, Status: fr.Status, Details: fr.Details})
+		}
+	},
+}
+
+// servicePlatform returns the service manager to use: --platform, or the one of this OS
+func servicePlatform(cmd *cobra.Command) string {
+	platform, _ := cmd.Flags().GetString("platform")
+	if platform == "" {
+		if runtime.GOOS == "darwin" {
+			return platformLaunchd
+		}
+		return platformSystemd
+	}
+	if platform != platformSystemd && platform != platformLaunchd {
+		fail("Error: invalid --platform %q (expected systemd or launchd).", platform)
+	}
+	return platform
+}
+
+// serviceSpec describes the service for mode from the running binary and the resolved config
+func serviceSpec(mode string, interval time.Duration) (ops.ServiceSpec, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return ops.ServiceSpec{}, fmt.Errorf("cannot locate the agents binary: %v", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	spec := ops.ServiceSpec{
+		Mode:       mode,
+		Executable: exe,
+		Interval:   interval,
+		Env:        map[string]string{},
+	}
+	if used := viper.ConfigFileUsed(); used != "" {
+		spec.ConfigFile = absPath(used)
+	}
+	for _, k := range serviceEnv {
+		if v := os.Getenv(k); v != "" {
+			spec.Env[k] = v
+		}
+	}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, "AGENTS_") && v != "" {
+			spec.Env[k] = v
+		}
+	}
+	if stateHome, err := config.GetStateHome(); err == nil {
+		spec.LogPath = filepath.Join(stateHome, "agent-smith", "service.log")
+	}
+	if mode == ops.ServicePath {
+		spec.WatchPaths = serviceWatchPaths()
+	}
+	return spec, nil
+}
+
+// serviceWatchPaths are the directories whose changes trigger a reconcile in path mode: the persona
+// directories only, as the directories of targets are written by the reconcile itself
+func serviceWatchPaths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(p string) {
+		p = absPath(ops.ExpandPath(p))
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	for _, dir := range getAgentsDirs() {
+		if info, err := os.Stat(ops.ExpandPath(dir)); err == nil && info.IsDir() {
+			add(dir)
+		}
+	}
+	return paths
+}
+
+// serviceDir is where the service files of platform live
+func serviceDir(platform string) (string, error) {
+	if platform == platformLaunchd {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "LaunchAgents"), nil
+	}
+	configHome, err := config.GetConfigHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configHome, "systemd", "user"), nil
+}
+
+// serviceFiles generates the files of spec for platform
+func serviceFiles(platform string, spec ops.ServiceSpec) ([]ops.ServiceFile, error) {
+	dir, err := serviceDir(platform)
+	if err != nil {
+		return nil, err
+	}
+	if platform == platformLaunchd {
+		f, err := ops.LaunchdPlist(spec, dir)
+		if err != nil {
+			return nil, err
+		}
+		return []ops.ServiceFile{f}, nil
+	}
+	return ops.SystemdUnits(spec, dir)
+}
+
+// installedServiceFiles returns the service files of platform that exist
+func installedServiceFiles(platform string) []string {
+	dir, err := serviceDir(platform)
+	if err != nil {
+		return nil
+	}
+	exts := []string{".service", ".timer", ".path"}
+	if platform == platformLaunchd {
+		exts = []string{".plist"}
+	}
+	var paths []string
+	for _, ext := range exts {
+		path := filepath.Join(dir, ops.ServiceName+ext)
+		if _, err := os.Lstat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// installedServiceMode infers the mode of the installed service from its files
+func installedServiceMode(platform string) string {
+	dir, err := serviceDir(platform)
+	if err != nil {
+		return ops.ServiceWatch
+	}
+	if platform == platformLaunchd {
+		data, err := os.ReadFile(filepath.Join(dir, ops.ServiceName+".plist"))
+		switch {
+		case err != nil:
+		case strings.Contains(string(data), "<key>StartInterval</key>"):
+			return ops.ServiceTimer
+		case strings.Contains(string(data), "<key>WatchPaths</key>"):
+			return ops.ServicePath
+		}
+		return ops.ServiceWatch
+	}
+	for _, mode := range []string{ops.ServiceTimer, ops.ServicePath} {
+		if _, err := os.Lstat(filepath.Join(dir, ops.SystemdEnableUnit(mode))); err == nil {
+			return mode
+		}
+	}
+	return ops.ServiceWatch
+}
+
+// serviceUnit is the name the service manager knows the service by
+func serviceUnit(platform, mode string) string {
+	if platform == platformLaunchd {
+		return ops.ServiceName
+	}
+	return ops.SystemdEnableUnit(mode)
+}
+
+// writeServiceFile writes f, creating its directory
+func writeServiceFile(f ops.ServiceFile) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path, []byte(f.Content), 0644)
+}
+
+// startCommands enable and start the service
+func startCommands(platform, mode string) [][]string {
+	if platform == platformLaunchd {
+		dir, _ := serviceDir(platform)
+		plist := filepath.Join(dir, ops.ServiceName+".plist")
+		return [][]string{
+			{"launchctl", "unload", plist},
+			{"launchctl", "load", "-w", plist},
+		}
+	}
+	return [][]string{
+		{"systemctl", "--user", "daemon-reload"},
+		{"systemctl", "--user", "enable", "--now", ops.SystemdEnableUnit(mode)},
+	}
+}
+
+// stopService stops and disables the installed service; failures are ignored since the
+// service may not be loaded
+func stopService(platform, mode string) {
+	if platform == platformLaunchd {
+		dir, _ := serviceDir(platform)
+		runServiceCommand([]string{"launchctl", "unload", "-w", filepath.Join(dir, ops.ServiceName+".plist")})
+		return
+	}
+	runServiceCommand([]string{"systemctl", "--user", "disable", "--now", ops.SystemdEnableUnit(mode)})
+	if mode != ops.ServiceWatch {
+		runServiceCommand([]string{"systemctl", "--user", "stop", ops.ServiceName + ".service"})
+	}
+}
+
+// runServiceCommands runs the commands in order. Only the error of the last one is
+// returned: the earlier ones prepare it and may fail harmlessly (e.g. unloading an agent
+// that is not loaded).
+func runServiceCommands(cmds [][]string) error {
+	var err error
+	for _, args := range cmds {
+		err = runServiceCommand(args)
+	}
+	return err
+}
+
+func runServiceCommand(args []string) error {
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return fmt.Errorf("%s not found; run: %s", args[0], strings.Join(args, " "))
+	}
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// serviceActive asks the service manager whether the service runs, "" if it cannot tell
+func serviceActive(platform, mode string) string {
+	var args []string
+	if platform == platformLaunchd {
+		args = []string{"launchctl", "list", ops.ServiceName}
+	} else {
+		args = []string{"systemctl", "--user", "is-active", ops.SystemdEnableUnit(mode)}
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return ""
+	}
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if platform == platformLaunchd {
+		if err != nil {
+			return "not loaded"
+		}
+		return "loaded"
+	}
+	if state := strings.TrimSpace(string(out)); state != "" {
+		return state
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceStatusCmd)
+
+	serviceCmd.PersistentFlags().String("platform", "", "Service manager: systemd or launchd (default: launchd on macOS, systemd elsewhere)")
+	serviceInstallCmd.Flags().String("mode", ops.ServiceWatch, "What the service runs: watch, timer or path")
+	serviceInstallCmd.Flags().Duration("interval", 0, "Reconcile period of the timer mode (default 15m); poll interval passed to watch")
+	serviceInstallCmd.Flags().Bool("print", false, "Print the service files instead of writing them")
+	serviceInstallCmd.Flags().Bool("files-only", false, "Only write the files; do not call systemctl or launchctl")
+	serviceUninstallCmd.Flags().Bool("files-only", false, "Only remove the files; do not call systemctl or launchctl")
+}
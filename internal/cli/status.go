@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -16,8 +18,16 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show current persona status",
-	Long:  `Show which persona is currently active by checking the AGENTS.md symlink.`,
+	Long: `Show which persona is currently active by checking the AGENTS.md symlink.
+
+If a persona activated with use --for has expired, status first switches back to the
+saved persona (writing its targets and the state file), unless --dry-run is given.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		// End a time-boxed persona (use --for) that ran out; this is the one thing status changes
+		if err := revertExpired(); err != nil {
+			warnf("Warning: %v\n", err)
+		}
+
 		// Load state first
 		st, err := state.LoadState()
 		if err != nil {
@@ -33,16 +43,98 @@ var statusCmd = &cobra.Command{
 
 		// Infer active persona
 		activePersona := inferPersona(canonical)
+		agentsDirs := getAgentsDirs()
+
+		report := StatusReport{
+			ActivePersona:   activePersona,
+			CanonicalTarget: ops.ExpandPath(canonical),
+			Personas:        []StatusPersonaReport{},
+		}
+		if ProjectCfg != nil {
+			report.ProjectConfig = ProjectCfg.Path
+		}
+		if pin := findPin(); pin != nil {
+			pr := &PinReport{Persona: pin.Persona, File: pin.Path, Project: pin.Dir, InSync: true}
+			pr.Targets = pinTargetReports(st, pin, projectTargets(pin), loadPersonaSource(pin.Persona, agentsDirs))
+			for _, tr := range pr.Targets {
+				if tr.Status != statusOK {
+					pr.InSync = false
+				}
+			}
+			report.Pin = pr
+		}
+		report.Stack = stackReports(st.Stack)
+
+		// Iterate over all known personas in state
+		activeFile := findAgentFile(st, activePersona)
+		foundActiveInState := false
+		for i := range st.AgentFiles {
+			af := &st.AgentFiles[i]
+			pr := StatusPersonaReport{
+				Name:    af.Name,
+				Path:    af.Path,
+				Active:  af == activeFile,
+				Tracked: true,
+				Targets: []TargetReport{},
+			}
+			if pr.Active {
+				foundActiveInState = true
+			}
+			dirs := agentFileDirs(af, agentsDirs)
+			if p, err := ops.LoadPersona(af.Name, dirs); err == nil && len(p.Chain) > 1 {
+				pr.Chain = p.Chain
+			}
+			source := loadPersonaSource(af.Name, dirs)
+			for _, t := range af.Targets {
+				pr.Targets = append(pr.Targets, checkTargetStatus(t, af.Name, source))
+			}
+			report.Personas = append(report.Personas, pr)
+		}
+
+		// If there is an active persona NOT in state, report it against the config targets
+		if activePersona != "" && !foundActiveInState {
+			pr := StatusPersonaReport{
+				Name:    activePersona,
+				Active:  true,
+				Targets: []TargetReport{},
+			}
+			for _, t := range Cfg.Targets {
+				pr.Targets = append(pr.Targets, checkTargetStatus(state.TargetState{Path: t.Path, Mode: t.Mode, Variants: t.Variants}, activePersona, personaSource{}))
+			}
+			report.Personas = append(report.Personas, pr)
+		}
+
+		if structuredOutput() {
+			emit(report)
+			return
+		}
 
 		fmt.Printf("Status Check:\n\n")
+		if report.ProjectConfig != "" {
+			fmt.Printf("Project config: %s\n\n", report.ProjectConfig)
+		}
+		if pr := report.Pin; pr != nil {
+			syncStr := "IN SYNC"
+			if !pr.InSync {
+				syncStr = "OUT OF SYNC, run 'agents sync'"
+			}
+			fmt.Printf("Project pin: %s (%s) [%s]\n", pr.Persona, pr.File, syncStr)
+			for _, tr := range pr.Targets {
+				printTargetReport(tr)
+			}
+			fmt.Println()
+		}
+		if len(report.Stack) > 0 {
+			printStack(report.Stack)
+		}
 
 		if len(st.AgentFiles) == 0 {
 			// Check if we have active persona even without state (legacy/fresh)
 			if activePersona != "" {
 				fmt.Printf("Active Persona: %s (Not tracked in state)\n", activePersona)
 				fmt.Println(" Targets (from config):")
-				for _, t := range Cfg.Targets {
-					printTargetStatus(state.TargetState{Path: t.Path, Mode: t.Mode}, activePersona)
+				for _, tr := range report.Personas[0].Targets {
+					printTargetReport(tr)
 				}
 			} else {
 				fmt.Println("No active persona and no state found.")
@@ -50,42 +142,35 @@ var statusCmd = &cobra.Command{
 			return
 		}
 
-		// Iterate over all known personas in state
-		for _, af := range st.AgentFiles {
-			isActive := (af.Name == activePersona)
+		for _, pr := range report.Personas {
+			if !pr.Tracked {
+				fmt.Printf("Persona: %s [ACTIVE] (Config only)\n", pr.Name)
+				fmt.Println("  Targets:")
+				for _, tr := range pr.Targets {
+					printTargetReport(tr)
+				}
+				continue
+			}
+
 			statusStr := ""
-			if isActive {
+			if pr.Active {
 				statusStr = " [ACTIVE]"
 			}
 
-			fmt.Printf("Persona: %s%s\n", af.Name, statusStr)
-			if af.Path != "" {
-				fmt.Printf("  File: %s\n", af.Path)
+			fmt.Printf("Persona: %s%s\n", pr.Name, statusStr)
+			if pr.Path != "" {
+				fmt.Printf("  File: %s\n", pr.Path)
+			}
+			if len(pr.Chain) > 1 {
+				fmt.Printf("  Chain: %s\n", strings.Join(pr.Chain, " -> "))
 			}
 			fmt.Println("  Targets:")
 
-			for _, t := range af.Targets {
-				printTargetStatus(t, af.Name)
+			for _, tr := range pr.Targets {
+				printTargetReport(tr)
 			}
 			fmt.Println()
 		}
-
-		// If there is an active persona NOT in state?
-		foundActiveInState := false
-		for _, af := range st.AgentFiles {
-			if af.Name == activePersona {
-				foundActiveInState = true
-				break
-			}
-		}
-
-		if activePersona != "" && !foundActiveInState {
-			fmt.Printf("Persona: %s [ACTIVE] (Config only)\n", activePersona)
-			fmt.Println("  Targets:")
-			for _, t := range Cfg.Targets {
-				printTargetStatus(state.TargetState{Path: t.Path, Mode: t.Mode}, activePersona)
-			}
-		}
 	},
 }
 
@@ -111,57 +196,154 @@ func inferPersona(path string) string {
 	return ""
 }
 
-func printTargetStatus(target state.TargetState, personaName string) {
-	targetPath := ops.ExpandPath(target.Path)
-	// We need the source path to verify
-	DisplayPath := targetPath
-	if len(targetPath) > 40 {
-		DisplayPath = "..." + targetPath[len(targetPath)-37:]
+// activePersona returns the persona the canonical target points to, or "" if none
+func activePersona() string {
+	canonical := viper.GetString("target_file")
+	if st, err := state.LoadState(); err == nil && st != nil && st.CanonicalTarget != "" {
+		canonical = st.CanonicalTarget
 	}
+	return inferPersona(canonical)
+}
 
-	info, err := os.Lstat(targetPath)
+// personaSource is what a persona currently renders from, compared with what was recorded at apply time
+type personaSource struct {
+	Hash    string
+	ModTime time.Time
+}
 
-	status := "OK"
-	details := ""
+// loadPersonaSource returns the hash and modification time of the resolved persona,
+// or a zero personaSource if it cannot be loaded
+func loadPersonaSource(persona string, agentsDirs []string) personaSource {
+	p, err := ops.LoadPersona(persona, agentsDirs)
+	if err != nil {
+		return personaSource{}
+	}
+	return personaSource{Hash: ops.HashContent(p.Content), ModTime: p.SourceModTime()}
+}
+
+// checkTargetStatus compares a target on disk with what the persona should have produced.
+// source describes the resolved persona as it is now (zero if unknown).
+func checkTargetStatus(target state.TargetState, personaName string, source personaSource) TargetReport {
+	targetPath := ops.ExpandPath(target.Path)
+	report := TargetReport{Path: targetPath, Mode: target.Mode, Status: statusOK}
+	if report.Mode == "" {
+		report.Mode = config.TargetModeLink
+	}
+
+	// A target with a variant is compared with the variant persona
+	if variant := targetPersona(target, personaName); variant != personaName {
+		report.Persona = variant
+		personaName = variant
+		if source.Hash != "" {
+			source = loadPersonaSource(variant, getAgentsDirs())
+		}
+	}
 
+	info, err := os.Lstat(targetPath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			status = "MISSING"
+			report.Status = statusMissing
 		} else {
-			status = "ERROR"
-			details = fmt.Sprintf("(%v)", err)
-		}
-	} else {
-		if target.Mode == config.TargetModeLink {
-			if info.Mode()&os.ModeSymlink == 0 {
-				status = "DRIFT"
-				details = "(Not a symlink)"
+			report.Status = statusError
+			report.Details = err.Error()
+		}
+		return report
+	}
+
+	if report.Mode == config.TargetModeLink {
+		if info.Mode()&os.ModeSymlink == 0 {
+			report.Status = statusDrift
+			report.Details = "Not a symlink"
+		} else {
+			linkDest, err := os.Readlink(targetPath)
+			if err != nil {
+				report.Status = statusError
+				report.Details = fmt.Sprintf("Readlink failed: %v", err)
 			} else {
-				linkDest, err := os.Readlink(targetPath)
-				if err != nil {
-					status = "ERROR"
-					details = fmt.Sprintf("(Readlink failed: %v)", err)
-				} else {
-					expectedSuffix := fmt.Sprintf("AGENTS.%s.md", personaName)
-					if filepath.Base(linkDest) != expectedSuffix {
-						status = "DRIFT"
-						details = fmt.Sprintf("(Points to %s)", filepath.Base(linkDest))
+				expectedSuffix := fmt.Sprintf("AGENTS.%s.md", personaName)
+				if filepath.Base(linkDest) != expectedSuffix {
+					report.Status = statusDrift
+					report.Details = fmt.Sprintf("Points to %s", filepath.Base(linkDest))
+				} else if target.Render || target.Hash != "" {
+					// Rendered links (render: true or composed personas) point at a generated copy that can go stale or be edited
+					checkContentDrift(&report, targetPath, target, source)
+					if report.Status == statusOK {
+						report.Details = "Rendered copy at " + linkDest + "; run 'agents reconcile' after editing the persona"
 					}
 				}
 			}
-		} else if target.Mode == config.TargetModeCopy {
-			if info.Mode()&os.ModeSymlink != 0 {
-				status = "DRIFT"
-				details = "(Is a symlink, expected copy)"
-			} else {
-				// Copy check - maybe check content hash? Too expensive?
-				// Just checking existence for now is fine for "OK" vs "MISSING".
-				// "Drift" for copy implies content mismatch, which we can't easily check without source.
-			}
 		}
+	} else if report.Mode == config.TargetModeCopy {
+		if info.Mode()&os.ModeSymlink != 0 {
+			report.Status = statusDrift
+			report.Details = "Is a symlink, expected copy"
+		} else {
+			checkContentDrift(&report, targetPath, target, source)
+		}
+	}
+
+	return report
+}
+
+// targetPersona returns the persona a target gets while persona is active: its recorded variant,
+// else the one its variants table maps persona to
+func targetPersona(target state.TargetState, persona string) string {
+	if target.Variant != "" {
+		return target.Variant
+	}
+	return target.TargetConfig().PersonaFor(persona)
+}
+
+// checkContentDrift compares the content of a written target with the hashes recorded at apply time.
+// Targets recorded before hashes were tracked are left as OK.
+func checkContentDrift(report *TargetReport, targetPath string, target state.TargetState, source personaSource) {
+	if target.Hash == "" {
+		return
+	}
+
+	current, err := ops.HashFile(targetPath)
+	if err != nil {
+		report.Status = statusError
+		report.Details = err.Error()
+		return
+	}
+
+	modified := current != target.Hash
+	stale := source.Hash != "" && target.SourceHash != "" && source.Hash != target.SourceHash
+
+	switch {
+	case modified && stale:
+		report.Status = statusConflict
+		report.Details = "Edited locally and source persona changed since apply"
+	case modified:
+		report.Status = statusModified
+		report.Details = "Edited locally since apply"
+	case stale:
+		report.Status = statusStale
+		report.Details = "Source persona changed since apply"
+		if !source.ModTime.IsZero() && source.ModTime.After(target.SourceModTime) {
+			report.Details += ", edited " + source.ModTime.Local().Format("2006-01-02 15:04")
+		}
+	}
+}
+
+func printTargetReport(report TargetReport) {
+	// Shorten long paths for display
+	displayPath := report.Path
+	if len(displayPath) > 40 {
+		displayPath = "..." + displayPath[len(displayPath)-37:]
+	}
+
+	if report.Persona != "" {
+		displayPath += " as " + report.Persona
+	}
+
+	details := ""
+	if report.Details != "" {
+		details = fmt.Sprintf("(%s)", report.Details)
 	}
 
-	fmt.Printf("    [%s] %s %s\n", status, DisplayPath, details)
+	fmt.Printf("    [%s] %s %s\n", report.Status, displayPath, details)
 }
 
 func init() {
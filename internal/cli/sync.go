@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/config"
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Apply the project's pinned persona to the project's targets",
+	Long: `Apply the persona pinned for the current project to the project's targets.
+
+The pin is read from a .agents-persona file (the persona name on its own line) or the
+persona field of .agents.yaml, in the working directory or its nearest parent. The
+project's targets are the targets of the .agents.yaml next to the pin, or
+<project>/AGENTS.md when there are none. The user's canonical target and other targets are left alone.
+
+Example:
+  echo coder > .agents-persona
+  agents sync`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+
+		pin := findPin()
+		if pin == nil {
+			fail("Error: no pinned persona found (add a %s file or set persona in %s).", config.PinFileName, config.ProjectConfigName)
+		}
+
+		agentsDirs := getAgentsDirs()
+		textf("Syncing %s to pinned persona: %s\n", pin.Dir, pin.Persona)
+
+		if dryRun {
+			finishApplyPlan(newPlan("sync", pin.Persona), pin.Persona, agentsDirs, projectTargets(pin), Cfg.Vars)
+		}
+
+		report, err := syncPin(pin, agentsDirs, force, bestEffort)
+		if err != nil {
+			textf("Failed to sync: %v\n", err)
+			emit(report)
+			os.Exit(1)
+		}
+
+		forgetHookSync()
+		textf("Project synced.\n")
+		emit(report)
+	},
+}
+
+// syncPin applies the pinned persona to the project's targets and tracks them under it.
+// Targets edited locally are not overwritten unless force is set.
+func syncPin(pin *config.Pin, agentsDirs []string, force, bestEffort bool) (ApplyReport, error) {
+	targets := projectTargets(pin)
+
+	// Local edits of project copies are never overwritten silently
+	if !force {
+		st, err := state.LoadState()
+		if err != nil || st == nil {
+			st = &state.StatusState{}
+		}
+		source := loadPersonaSource(pin.Persona, agentsDirs)
+		var edited []TargetReport
+		for _, tr := range pinTargetReports(st, pin, targets, source) {
+			if tr.Status == statusModified || tr.Status == statusConflict {
+				edited = append(edited, tr)
+				textf("Target edited locally: %s\n", tr.Path)
+			}
+		}
+		if len(edited) > 0 {
+			err := fmt.Errorf("local edits would be overwritten; run 'agents capture <target>' or use --force")
+			return ApplyReport{Persona: pin.Persona, Targets: edited, Error: err.Error()}, err
+		}
+	}
+
+	backups, err := backupUnmanaged(targets, agentsDirs)
+	if err != nil {
+		err = fmt.Errorf("%w (refusing to overwrite)", err)
+		return ApplyReport{Persona: pin.Persona, Targets: []TargetReport{}, Error: err.Error()}, err
+	}
+
+	result, err := ops.ApplyPersonaWithOptions(pin.Persona, agentsDirs, targets, ops.ApplyOptions{
+		Vars:       Cfg.Vars,
+		Out:        textOut(),
+		BestEffort: bestEffort,
+	})
+	report := applyReport(pin.Persona, result, err)
+	report.Backups = backups
+	if err != nil {
+		if !bestEffort {
+			undoBackups(backups)
+			report.Backups = nil
+		}
+		return report, err
+	}
+
+	// Track the project targets under the pinned persona, keeping its other targets
+	synced := targetStates(result)
+	for i := range synced {
+		synced[i].Pinned = true
+	}
+	if err := state.TrackTargets(state.AgentFileState{Name: pin.Persona, Path: result.AgentPath}, synced); err != nil {
+		warnf("Warning: Failed to save status state: %v\n", err)
+	}
+	return report, nil
+}
+
+// findPin returns the pin of the project in the working directory, or nil.
+// Pins are ignored with --no-project.
+func findPin() *config.Pin {
+	if noProject {
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	pin, err := config.FindPin(cwd)
+	if err != nil {
+		fail("Error: %v", err)
+	}
+	return pin
+}
+
+// projectTargets returns the targets sync manages for the pinned project: those of the .agents.yaml
+// in the pin's directory, which is not the nearest one when the pin is in a parent or nested directory
+func projectTargets(pin *config.Pin) []config.TargetConfig {
+	pc := ProjectCfg
+	if pc == nil || filepath.Dir(pc.Path) != pin.Dir {
+		pc = nil
+		path := filepath.Join(pin.Dir, config.ProjectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			if pc, err = config.LoadProjectConfig(path); err != nil {
+				warnf("Warning: %v\n", err)
+			}
+		}
+	}
+	if pc != nil && len(pc.Targets) > 0 {
+		return pc.Targets
+	}
+	return []config.TargetConfig{{
+		Path: filepath.Join(pin.Dir, "AGENTS.md"),
+		Mode: config.TargetModeLink,
+	}}
+}
+
+// pinTargetReports checks each project target against the pinned persona
+func pinTargetReports(st *state.StatusState, pin *config.Pin, targets []config.TargetConfig, source personaSource) []TargetReport {
+	var reports []TargetReport
+	for _, t := range targets {
+		path := absPath(t.Path)
+		af, tracked := findTrackedTarget(st, pin.Persona, path)
+		switch {
+		case af != nil && af.Name == pin.Persona:
+			reports = append(reports, checkTargetStatus(*tracked, pin.Persona, source))
+		case af != nil:
+			reports = append(reports, TargetReport{Path: path, Mode: t.Mode, Status: statusDrift, Details: fmt.Sprintf("Uses '%s'", af.Name)})
+		default:
+			tr := TargetReport{Path: path, Mode: t.Mode, Status: statusMissing, Details: "Not synced"}
+			if _, err := os.Lstat(path); err == nil {
+				tr.Status = statusDrift
+			}
+			reports = append(reports, tr)
+		}
+		if reports[len(reports)-1].Mode == "" {
+			reports[len(reports)-1].Mode = config.TargetModeLink
+		}
+	}
+	return reports
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+
+	syncCmd.Flags().Bool("force", false, "Overwrite project targets that were edited locally")
+	syncCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+}
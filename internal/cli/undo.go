@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// Status of a path put back by undo
+const statusRestored = "RESTORED"
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo the last unuse or drop",
+	Long: `Put back the targets removed by the last unuse or drop and the state file as it was before.
+Each undo goes one command further back. The number of commands kept is set by
+journal_retention in the config. Only unuse and drop are journaled: use, sync, reconcile,
+capture, restore, push and pop cannot be undone.
+
+Undo refuses when a removed target path or the state file changed since; use --force
+to restore anyway.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		list, _ := cmd.Flags().GetBool("list")
+		force, _ := cmd.Flags().GetBool("force")
+
+		entries, err := state.LoadJournal()
+		if err != nil {
+			fail("Error: failed to read journal: %v", err)
+		}
+
+		if list {
+			report := JournalReport{Entries: []JournalEntryReport{}}
+			for i := len(entries) - 1; i >= 0; i-- {
+				report.Entries = append(report.Entries, journalEntryReport(entries[i]))
+			}
+			if structuredOutput() {
+				emit(report)
+				return
+			}
+			if len(report.Entries) == 0 {
+				fmt.Println("Nothing to undo.")
+				return
+			}
+			for _, e := range report.Entries {
+				fmt.Printf("%s  %s\n", e.Time, e.Command)
+				for _, f := range e.Files {
+					fmt.Printf("    %s\n", f)
+				}
+			}
+			return
+		}
+
+		if len(entries) == 0 {
+			msg := "Nothing to undo."
+			textf("%s\n", msg)
+			emit(UndoReport{Targets: []TargetReport{}, Message: msg})
+			return
+		}
+		last := entries[len(entries)-1]
+		report := UndoReport{Command: last.Command, Time: last.Time.Format(time.RFC3339), Targets: []TargetReport{}}
+
+		conflicts, err := last.Conflicts()
+		if err != nil {
+			fail("Error: %v", err)
+		}
+		if len(conflicts) > 0 && !force {
+			for _, c := range conflicts {
+				textf("Changed since '%s': %s\n", last.Command, c)
+			}
+			report.Error = "refusing to undo over later changes; use --force to restore anyway"
+			textf("Error: %s\n", report.Error)
+			emit(report)
+			os.Exit(1)
+		}
+
+		if dryRun {
+			plan := newPlan("undo", "")
+			for _, f := range last.Files {
+				switch {
+				case !f.Exists:
+					plan.add(ops.PlanRemove, f.Path, "")
+				case f.Link != "":
+					plan.add(ops.PlanCreateLink, f.Path, "-> "+f.Link)
+				default:
+					plan.add(ops.PlanCreateCopy, f.Path, "Previous content")
+				}
+			}
+			plan.add(ops.PlanRestoreState, "", "As before '"+last.Command+"'")
+			printPlan(plan)
+			return
+		}
+
+		if err := last.Undo(); err != nil {
+			report.Error = err.Error()
+			textf("Error: failed to undo '%s': %v\n", last.Command, err)
+			emit(report)
+			os.Exit(1)
+		}
+		for _, f := range last.Files {
+			report.Targets = append(report.Targets, TargetReport{Path: f.Path, Status: statusRestored})
+			textf("Restored: %s\n", f.Path)
+		}
+		textf("Undid '%s'.\n", last.Command)
+		emit(report)
+	},
+}
+
+func journalEntryReport(j *state.JournalEntry) JournalEntryReport {
+	r := JournalEntryReport{ID: j.ID, Time: j.Time.Format(time.RFC3339), Command: j.Command, Files: []string{}}
+	for _, f := range j.Files {
+		r.Files = append(r.Files, f.Path)
+	}
+	return r
+}
+
+// beginJournal starts journaling a command so that undo can revert it.
+// It returns nil (which records nothing) for dry runs and when the journal is disabled.
+func beginJournal() *state.JournalEntry {
+	if dryRun || Cfg.JournalRetention <= 0 {
+		return nil
+	}
+	j, err := state.BeginJournal(commandLine())
+	if err != nil {
+		warnf("Warning: cannot journal this command, it will not be undoable: %v\n", err)
+		return nil
+	}
+	return j
+}
+
+// commitJournal saves the journal of a command once it is done
+func commitJournal(j *state.JournalEntry) {
+	if err := j.Commit(Cfg.JournalRetention); err != nil {
+		warnf("Warning: failed to save the journal, this command cannot be undone: %v\n", err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().Bool("list", false, "List the commands that can be undone, most recent first")
+	undoCmd.Flags().Bool("force", false, "Restore even if targets or the state changed since")
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 
@@ -30,12 +31,24 @@ var unuseCmd = &cobra.Command{
 			// Fallback to state if config is empty (e.g. relying on defects?)
 			// But duplicate logic from status/use might be needed.
 			// Let's rely on Cfg.Targets as initConfig ensures backward compatibility.
-			fmt.Println("No targets configured to remove.")
+			msg := "No targets configured to remove."
+			textf("%s\n", msg)
+			emit(RemoveReport{Targets: []TargetReport{}, Message: msg})
 			return
 		}
 
+		force, _ := cmd.Flags().GetBool("force")
+		agentsDirs := getAgentsDirs()
+		st, err := state.LoadState()
+		if err != nil || st == nil {
+			st = &state.StatusState{}
+		}
+
 		removedCount := 0
 		errCount := 0
+		report := RemoveReport{Targets: []TargetReport{}}
+		plan := newPlan("unuse", "")
+		journal := beginJournal()
 
 		for _, target := range targets {
 			targetPath := ops.ExpandPath(target.Path)
@@ -44,64 +57,129 @@ var unuseCmd = &cobra.Command{
 			if _, err := os.Lstat(targetPath); err != nil {
 				if os.IsNotExist(err) {
 					// Already gone, skip
+					report.Targets = append(report.Targets, TargetReport{Path: targetPath, Mode: target.Mode, Status: statusMissing})
+					continue
+				}
+				textf("Error accessing %s: %v\n", targetPath, err)
+				report.Targets = append(report.Targets, TargetReport{Path: targetPath, Mode: target.Mode, Status: statusError, Details: err.Error()})
+				errCount++
+				continue
+			}
+
+			// Only remove what we can prove we wrote
+			if !force {
+				_, tracked := findTrackedTarget(st, "", targetPath)
+				if owned, reason := checkOwnership(absPath(targetPath), tracked, agentsDirs); !owned {
+					if dryRun {
+						plan.add(ops.PlanSkipForeign, targetPath, reason)
+						continue
+					}
+					textf("Refusing to remove %s: %s (use --force to remove anyway)\n", targetPath, reason)
+					report.Targets = append(report.Targets, TargetReport{Path: targetPath, Mode: target.Mode, Status: statusSkipped, Details: reason})
 					continue
 				}
-				fmt.Printf("Error accessing %s: %v\n", targetPath, err)
+			}
+
+			if dryRun {
+				plan.add(ops.PlanRemove, targetPath, "")
+				continue
+			}
+
+			// Keep what is removed so that undo can put it back
+			if err := journal.Record(targetPath); err != nil {
+				textf("Error journaling %s, not removed: %v\n", targetPath, err)
+				report.Targets = append(report.Targets, TargetReport{Path: targetPath, Mode: target.Mode, Status: statusError, Details: err.Error()})
 				errCount++
 				continue
 			}
 
 			// Remove
 			if err := os.Remove(targetPath); err != nil {
-				fmt.Printf("Error removing %s: %v\n", targetPath, err)
+				textf("Error removing %s: %v\n", targetPath, err)
+				report.Targets = append(report.Targets, TargetReport{Path: targetPath, Mode: target.Mode, Status: statusError, Details: err.Error()})
 				errCount++
 			} else {
-				fmt.Printf("Removed: %s\n", targetPath)
+				textf("Removed: %s\n", targetPath)
+				report.Targets = append(report.Targets, TargetReport{Path: targetPath, Mode: target.Mode, Status: statusRemoved})
 				removedCount++
+				removeRendered(journal, targetPath, "")
 			}
 		}
 
-		// Update state to clear last persona?
-		// We should probably clear the last persona in status.yaml
-		// to reflect that no persona is active.
-		// However, we still might want to know what targets we managed?
-		// Let's clear LastPersona but keep Targets (or clear them too?)
-		// If we clear targets, status will show nothing.
-		// If we keep targets, status will show MISSING.
-		// Usually "unuse" means "I don't want an agent active".
-		// So clearing LastPersona is correct.
-		// Clearning Targets logic: if we don't have targets in state, status won't verify them.
-		// This seems correct for "unuse".
-
-		// We should probably clear the last persona in status.yaml
-		// to reflect that no persona is active.
-		// With new schema, we set CanonicalTarget to empty.
-
-		// In new schema, we might want to keep the AgentFile entry but just ensure targets are gone?
-		// But SaveState appends/updates.
-		// If we want to "unuse" everything, we probably just want to clear CanonicalTarget.
-		// But existing SaveState logic loads state and modifies it.
-		// If we pass empty strings, SaveState might create an empty entry.
-
-		// Let's manually load and clear CanonicalTarget.
-		st, err := state.LoadState()
-		if err == nil && st != nil {
+		if dryRun {
+			printPlan(plan)
+			return
+		}
+
+		// No persona is active any more. Only the targets that were removed (or already gone) stop
+		// being tracked: skipped and failed ones are still on disk and stay visible to status.
+		if st, err := state.LoadState(); err == nil && st != nil {
 			st.CanonicalTarget = "" // Clear the active symlink pointer
-			st.AgentFiles = nil     // Clear managed personas
+			for _, tr := range report.Targets {
+				if tr.Status == statusRemoved || tr.Status == statusMissing {
+					untrackTarget(st, absPath(tr.Path))
+				}
+			}
+			var kept []state.AgentFileState
+			for _, af := range st.AgentFiles {
+				if len(af.Targets) > 0 {
+					kept = append(kept, af)
+				}
+			}
+			st.AgentFiles = kept
 
 			if err := state.WriteState(st); err != nil {
-				fmt.Printf("Warning: Failed to update state file: %v\n", err)
+				warnf("Warning: Failed to update state file: %v\n", err)
 			}
 		}
+		commitJournal(journal)
+		forgetHookSync()
+
+		if structuredOutput() {
+			emit(report)
+			return
+		}
 
 		if removedCount > 0 {
 			fmt.Printf("Successfully removed %d targets.\n", removedCount)
 		} else if errCount == 0 {
 			fmt.Println("No targets needed removal.")
 		}
+		offerRestore(removedPaths(report))
 	},
 }
 
+// removeRendered deletes the rendered copies kept for a link target (see ops.RenderedDir), or only the
+// one of persona if it is set. The copy the target still links to is kept. Removed copies are journaled
+// so that undo can put them back together with the target.
+func removeRendered(journal *state.JournalEntry, targetPath, persona string) {
+	dir, err := ops.RenderedDir(targetPath)
+	if err != nil {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	linkDest, _ := os.Readlink(targetPath)
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if path == linkDest || (persona != "" && e.Name() != fmt.Sprintf("AGENTS.%s.md", persona)) {
+			continue
+		}
+		if err := journal.Record(path); err != nil {
+			warnf("Warning: keeping %s, failed to journal it: %v\n", path, err)
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			warnf("Warning: failed to remove %s: %v\n", path, err)
+		}
+	}
+	os.Remove(dir) // Only succeeds once it is empty
+}
+
 func init() {
 	rootCmd.AddCommand(unuseCmd)
+
+	unuseCmd.Flags().Bool("force", false, "Remove targets even if they were not written by agent-smith")
 }
@@ -6,6 +6,8 @@ import (
 	"agent-smith/internal/state"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -16,15 +18,26 @@ var useCmd = &cobra.Command{
 	Use:   "use [persona]",
 	Short: "Switch to a specific persona",
 	Long: `Switch the current AGENTS.md symlink to point to the specified persona.
-Example: agents use coder`,
-	Args: cobra.ExactArgs(1),
+Without an argument the persona pinned for the project (.agents-persona or .agents.yaml) is used.
+"agents use -" switches back to the previously active persona (see agents log).
+With --for the current persona comes back by itself once the time is up.
+Example: agents use coder
+         agents use coder --set team=platform
+         agents use -
+         agents use reviewer --for 2h`,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		persona := args[0]
-		agentsDirs := viper.GetStringSlice("agents_dir")
-		if len(agentsDirs) == 0 {
-			if s := viper.GetString("agents_dir"); s != "" {
-				agentsDirs = []string{s}
-			}
+		var persona string
+		if len(args) == 1 && args[0] == "-" {
+			persona = previousPersona()
+			textf("Switching back to persona '%s'\n", persona)
+		} else if len(args) == 1 {
+			persona = args[0]
+		} else if pin := findPin(); pin != nil {
+			persona = pin.Persona
+			textf("Using pinned persona '%s' from %s\n", persona, pin.Path)
+		} else {
+			fail("Error: no persona given and none pinned (%s or persona in %s).", config.PinFileName, config.ProjectConfigName)
 		}
 
 		// Canonical System Path (from Config/Env/Default) - defines "Active" status
@@ -51,35 +64,170 @@ Example: agents use coder`,
 			targetsToApply = append(targetsToApply, dynamicTarget)
 		}
 
-		// Apply Logic ONCE
-		var err error
-		var agentPath string
+		// Template variables: config vars overridden by --set
+		setPairs, _ := cmd.Flags().GetStringArray("set")
+		setVars, err := ops.ParseVars(setPairs)
+		if err != nil {
+			fail("Error: %v", err)
+		}
+
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+		if duration, _ := cmd.Flags().GetDuration("for"); duration != 0 {
+			pushPersona("use", persona, targetsToApply, setVars, bestEffort, expiry(duration))
+			return
+		}
+		switchPersona("use", persona, targetsToApply, setVars, bestEffort)
+	},
+}
+
+// switchPersona applies persona to targetsToApply, records it as active and reports the result (use, auto, push, pop)
+func switchPersona(command, persona string, targetsToApply []config.TargetConfig, setVars map[string]string, bestEffort bool) {
+	report := applySwitch(command, persona, targetsToApply, setVars, bestEffort)
+	printSwitched(report)
+}
+
+// applySwitch does the switch of switchPersona without reporting it, so that the caller can add to
+// the report first. If the switch fails the report is emitted and the command exits.
+func applySwitch(command, persona string, targetsToApply []config.TargetConfig, setVars map[string]string, bestEffort bool) ApplyReport {
+	if dryRun {
+		finishApplyPlan(newPlan(command, persona), persona, getAgentsDirs(), targetsToApply, ops.MergeVars(Cfg.Vars, setVars))
+	}
+
+	report, err := activatePersona(persona, targetsToApply, setVars, bestEffort)
+	if err != nil {
+		// ApplyPersona prints specific errors
+		emit(report)
+		os.Exit(1)
+	}
+	return report
+}
+
+// printSwitched reports a successful switch
+func printSwitched(report ApplyReport) {
+	if structuredOutput() {
+		emit(report)
+		return
+	}
 
-		agentPath, err = ops.ApplyPersona(persona, agentsDirs, targetsToApply)
+	fmt.Println("The mind was never changed; only where it points.")
+	fmt.Printf("Persona switched: %s\n", report.Persona)
+}
+
+// activatePersona applies persona to targetsToApply and records it as the active persona in
+// the state and the history. Nothing is recorded if the apply fails.
+func activatePersona(persona string, targetsToApply []config.TargetConfig, setVars map[string]string, bestEffort bool) (ApplyReport, error) {
+	agentsDirs := getAgentsDirs()
+	canonicalTarget := viper.GetString("target_file")
+
+	// Move aside files we did not create so they are not destroyed
+	var backups []BackupReport
+	if _, err := ops.FindPersona(persona, agentsDirs); err == nil {
+		backups, err = backupUnmanaged(targetsToApply, agentsDirs)
 		if err != nil {
-			// ApplyPersona prints specific errors
-			os.Exit(1)
+			err = fmt.Errorf("%w (refusing to overwrite)", err)
+			textf("Error: %v\n", err)
+			return ApplyReport{Persona: persona, Targets: []TargetReport{}, Error: err.Error()}, err
 		}
+	}
 
-		// Update Cfg.Targets in memory? No need, we used a local slice.
-		// But for SaveState, we want to reflect what we just did?
-		// Actually, if we added a dynamic target, should `status` track it?
-		// If so, we should pass `targetsToApply` to SaveState.
-		// If the user said "use --target-file foo", they expect foo to be tracked?
-		// Probably yes.
-
-		// Save state for 'status' command
-		// We *always* pass the Canonical Target to SaveState, ensuring status tracks the System Active.
-		if err := state.SaveState(canonicalTarget, persona, agentPath, targetsToApply); err != nil {
-			// Don't fail the operation, but warn user
-			fmt.Printf("Warning: Failed to save status state: %v\n", err)
+	// Apply Logic ONCE
+	result, err := ops.ApplyPersonaWithOptions(persona, agentsDirs, targetsToApply, ops.ApplyOptions{
+		Vars:       ops.MergeVars(Cfg.Vars, setVars),
+		Out:        textOut(),
+		BestEffort: bestEffort,
+	})
+	report := applyReport(persona, result, err)
+	report.Backups = backups
+	if err != nil {
+		if !bestEffort {
+			// All-or-nothing: put back the files moved aside for this apply too
+			undoBackups(backups)
+			report.Backups = nil
 		}
+		return report, err
+	}
 
-		fmt.Println("The mind was never changed; only where it points.")
-		fmt.Printf("Persona switched: %s\n", persona)
-	},
+	// Save state for 'status' command
+	// We *always* pass the Canonical Target to SaveState, ensuring status tracks the System Active.
+	// Dynamic targets (--target-file) are tracked too, and --set values are kept so reconcile renders the same way.
+	agentFile := state.AgentFileState{
+		Name:    persona,
+		Path:    result.AgentPath,
+		Targets: targetStates(result),
+	}
+	if len(setVars) > 0 {
+		agentFile.Vars = setVars
+	}
+	if err := state.RecordAgentFile(canonicalTarget, agentFile); err != nil {
+		// Don't fail the operation, but warn user
+		warnf("Warning: Failed to save status state: %v\n", err)
+	}
+	recordHistory(persona, result)
+	forgetHookSync()
+	return report, nil
+}
+
+// previousPersona returns the persona that was active before the current one (use -)
+func previousPersona() string {
+	history, err := state.LoadHistory()
+	if err != nil {
+		fail("Error: failed to read history: %v", err)
+	}
+	entry, ok := state.PreviousPersona(history, activePersona())
+	if !ok {
+		fail("Error: no previous persona in history.")
+	}
+	return entry.Persona
+}
+
+// recordHistory appends a successful activation to the history log
+func recordHistory(persona string, result *ops.ApplyResult) {
+	host, _ := os.Hostname()
+	entry := state.HistoryEntry{
+		Time:      time.Now().UTC(),
+		Persona:   persona,
+		AgentFile: result.AgentPath,
+		Targets:   []string{},
+		Host:      host,
+		Command:   commandLine(),
+	}
+	for _, t := range result.Targets {
+		entry.Targets = append(entry.Targets, t.Path)
+	}
+	if err := state.AppendHistory(entry); err != nil {
+		warnf("Warning: Failed to append to history: %v\n", err)
+	}
+}
+
+// commandLine is the command being run, as recorded in the history and the journal
+func commandLine() string {
+	return strings.Join(append([]string{"agents"}, os.Args[1:]...), " ")
+}
+
+// targetStates converts apply results into state targets, keeping the hashes needed for drift detection
+func targetStates(result *ops.ApplyResult) []state.TargetState {
+	var targets []state.TargetState
+	for _, t := range result.Targets {
+		targets = append(targets, state.TargetState{
+			Path:          t.Target.Path,
+			Mode:          t.Target.Mode,
+			Render:        t.Target.Render,
+			Marker:        t.Target.Marker,
+			Variants:      t.Target.Variants,
+			Variant:       t.Variant,
+			LinkDest:      t.LinkDest,
+			Hash:          t.Hash,
+			SourceHash:    t.SourceHash,
+			SourceModTime: t.SourceModTime,
+		})
+	}
+	return targets
 }
 
 func init() {
 	rootCmd.AddCommand(useCmd)
+
+	useCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+	useCmd.Flags().Duration("for", 0, "Switch back to the current persona after this long (e.g. 30m, 2h)")
+	useCmd.Flags().StringArray("set", []string{}, "set a template variable (key=value, can be specified multiple times)")
 }
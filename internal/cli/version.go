@@ -13,6 +13,10 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number of Agent Smith",
 	Run: func(cmd *cobra.Command, args []string) {
+		if structuredOutput() {
+			emit(VersionReport{Version: Version})
+			return
+		}
 		fmt.Println(Version)
 	},
 }
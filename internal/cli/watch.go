@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"agent-smith/internal/ops"
+	"agent-smith/internal/state"
+)
+
+// defaultWatchInterval is used when neither --interval nor watch_interval is set
+const defaultWatchInterval = 2 * time.Second
+
+// Events logged by watch
+const (
+	watchStart     = "start"
+	watchChange    = "change"
+	watchReconcile = "reconcile"
+	watchStop      = "stop"
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Reconcile continuously when targets or personas change",
+	Long: `Poll the canonical target, the tracked targets of the active persona and the files
+in the persona directories, and reconcile whenever one of them changes. Changes are
+debounced: reconcile runs once nothing changed for --debounce. A time-boxed persona
+(use --for) is switched back when it expires.
+
+Each event is logged on one line (logfmt for text, one object per line for json).
+SIGINT and SIGTERM stop the watch after the current reconcile.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if dryRun {
+			fail("Error: --dry-run is not supported by watch.")
+		}
+		interval := Cfg.WatchInterval
+		if cmd.Flags().Changed("interval") || interval <= 0 {
+			interval, _ = cmd.Flags().GetDuration("interval")
+		}
+		if interval <= 0 {
+			fail("Error: --interval must be positive.")
+		}
+		debounce, _ := cmd.Flags().GetDuration("debounce")
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+		if onConflict != conflictAbort && onConflict != conflictOverwrite {
+			fail("Error: invalid --on-conflict %q (expected abort or overwrite).", onConflict)
+		}
+		bestEffort, _ := cmd.Flags().GetBool("best-effort")
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Reconcile progress is replaced by the event log
+		quietText = true
+		defer func() { quietText = false }()
+
+		logWatch(WatchEvent{Level: "info", Event: watchStart, Persona: activePersona(),
+			Message: fmt.Sprintf("polling every %s", interval)})
+		stamps := reconcileAndStamp(onConflict, bestEffort, nil)
+		var pending []string
+		var lastChange time.Time
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logWatch(WatchEvent{Level: "info", Event: watchStop, Message: "received signal, stopping"})
+				return
+			case <-ticker.C:
+			}
+
+			current := ops.StampPaths(watchedPaths())
+			if changed := ops.ChangedPaths(stamps, current); len(changed) > 0 {
+				logWatch(WatchEvent{Level: "info", Event: watchChange, Paths: changed})
+				pending = mergePaths(pending, changed)
+				lastChange = time.Now()
+				stamps = current
+			}
+
+			expired := false
+			if top, err := state.PeekStack(); err == nil && top.Expired(time.Now()) {
+				expired = true
+			}
+
+			if expired || (len(pending) > 0 && time.Since(lastChange) >= debounce) {
+				stamps = reconcileAndStamp(onConflict, bestEffort, pending)
+				pending = nil
+			}
+		}
+	},
+}
+
+// reconcileWatched runs reconcile and logs the outcome
+func reconcileWatched(onConflict string, bestEffort bool, changed []string) {
+	report, err := reconcileActive(onConflict, bestEffort, false)
+	event := WatchEvent{Level: "info", Event: watchReconcile, Persona: report.Persona, Paths: changed, Message: report.Message}
+	for _, tr := range report.Targets {
+		if tr.Status != statusOK {
+			event.Targets = append(event.Targets, tr)
+		}
+	}
+	if err != nil {
+		event.Level = "error"
+		event.Error = err.Error()
+		event.Targets = report.Targets
+	}
+	logWatch(event)
+}
+
+// reconcileAndStamp reconciles and returns the stamps the next poll is compared with. Our own writes
+// to targets are not changes to react to, but persona files keep the stamps they had before the
+// reconcile, so edits made while it ran are picked up by the next poll.
+func reconcileAndStamp(onConflict string, bestEffort bool, changed []string) map[string]ops.FileStamp {
+	sources := ops.StampPaths(ops.PersonaSourceFiles(getAgentsDirs()))
+	reconcileWatched(onConflict, bestEffort, changed)
+
+	stamps := ops.StampPaths(watchedPaths())
+	for _, path := range ops.PersonaSourceFiles(getAgentsDirs()) {
+		delete(stamps, path)
+	}
+	for path, s := range sources {
+		stamps[path] = s
+	}
+	return stamps
+}
+
+// watchedPaths are the paths whose changes trigger a reconcile
+func watchedPaths() []string {
+	st, err := state.LoadState()
+	if err != nil || st == nil {
+		st = &state.StatusState{}
+	}
+	canonical := st.CanonicalTarget
+	if canonical == "" {
+		canonical = viper.GetString("target_file")
+	}
+	paths := []string{absPath(ops.ExpandPath(canonical))}
+
+	active := inferPersona(canonical)
+	for _, af := range st.AgentFiles {
+		if af.Name != active {
+			continue
+		}
+		for _, t := range af.Targets {
+			paths = append(paths, absPath(ops.ExpandPath(t.Path)))
+		}
+	}
+	return append(paths, ops.PersonaSourceFiles(getAgentsDirs())...)
+}
+
+// mergePaths adds the paths of b missing from a
+func mergePaths(a, b []string) []string {
+	seen := make(map[string]bool, len(a))
+	for _, p := range a {
+		seen[p] = true
+	}
+	for _, p := range b {
+		if !seen[p] {
+			a = append(a, p)
+			seen[p] = true
+		}
+	}
+	return a
+}
+
+// logWatch writes one event: a logfmt line for text, a JSON line, or a YAML document
+func logWatch(e WatchEvent) {
+	e.Time = time.Now().UTC().Format(time.RFC3339)
+	switch outputFormat {
+	case outputJSON:
+		data, _ := json.Marshal(e)
+		fmt.Println(string(data))
+	case outputYAML:
+		data, _ := yaml.Marshal(e)
+		fmt.Printf("---\n%s", data)
+	default:
+		fields := []string{"time=" + e.Time, "level=" + e.Level, "event=" + e.Event}
+		add := func(key, value string) {
+			if value != "" {
+				fields = append(fields, key+"="+logfmtValue(value))
+			}
+		}
+		add("persona", e.Persona)
+		add("paths", strings.Join(e.Paths, ","))
+		for _, tr := range e.Targets {
+			add("target", tr.Path+":"+tr.Status)
+		}
+		add("msg", e.Message)
+		add("error", e.Error)
+		fmt.Println(strings.Join(fields, " "))
+	}
+}
+
+// logfmtValue quotes a value containing spaces, quotes or an equals sign
+func logfmtValue(s string) string {
+	if strings.ContainsAny(s, " \"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().Duration("interval", defaultWatchInterval, "How often to poll for changes (default: watch_interval from the config)")
+	watchCmd.Flags().Duration("debounce", 500*time.Millisecond, "Wait until nothing changed for this long before reconciling")
+	watchCmd.Flags().String("on-conflict", conflictOverwrite, "How to handle locally edited copies: overwrite or abort")
+	watchCmd.Flags().Bool("best-effort", false, "Keep going when a target fails instead of rolling back every target")
+}
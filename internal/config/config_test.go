@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -103,3 +105,71 @@ func TestXDGOverrides(t *testing.T) {
 		t.Errorf("GetStateHome() = %s, want %s", got, xdgState)
 	}
 }
+
+func TestProjectConfig(t *testing.T) {
+	tempDir := t.TempDir()
+	project := filepath.Join(tempDir, "repo")
+	nested := filepath.Join(project, "src", "pkg")
+	os.MkdirAll(nested, 0755)
+
+	content := `
+persona: coder
+agents_dir: ["./.agents/personas", "shared"]
+targets:
+  - path: "./CLAUDE.md"
+    mode: "copy"
+  - path: "docs/../AGENTS.md"
+vars:
+  team: platform
+`
+	os.WriteFile(filepath.Join(project, ProjectConfigName), []byte(content), 0644)
+
+	path, err := FindProjectConfig(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(project, ProjectConfigName) {
+		t.Fatalf("FindProjectConfig() = %q, want the file in %s", path, project)
+	}
+
+	pc, err := LoadProjectConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc.Persona != "coder" || pc.Vars["team"] != "platform" {
+		t.Errorf("Unexpected project config: %+v", pc)
+	}
+	if pc.AgentsDir[0] != filepath.Join(project, ".agents", "personas") || pc.AgentsDir[1] != filepath.Join(project, "shared") {
+		t.Errorf("Persona dirs not resolved against the project: %v", pc.AgentsDir)
+	}
+	if pc.Targets[0].Path != filepath.Join(project, "CLAUDE.md") || pc.Targets[0].Mode != TargetModeCopy {
+		t.Errorf("Target not resolved against the project: %+v", pc.Targets[0])
+	}
+	if pc.Targets[1].Path != filepath.Join(project, "AGENTS.md") {
+		t.Errorf("Target not resolved against the project: %q", pc.Targets[1].Path)
+	}
+
+	// Nothing above the project
+	if path, err := FindProjectConfig(tempDir); err != nil || path != "" {
+		t.Errorf("Expected no project config above the project, got %q (%v)", path, err)
+	}
+}
+
+func TestProjectConfigPathsOutsideProject(t *testing.T) {
+	project := t.TempDir()
+	path := filepath.Join(project, ProjectConfigName)
+
+	for _, bad := range []string{"/etc/agents", "~", "~/.bashrc", "..", "../AGENTS.md", "docs/../../AGENTS.md"} {
+		for _, content := range []string{
+			fmt.Sprintf("agents_dir: [%q]\n", bad),
+			fmt.Sprintf("targets:\n  - path: %q\n", bad),
+		} {
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadProjectConfig(path); err == nil || !strings.Contains(err.Error(), "inside the project") {
+				t.Errorf("Expected %q to be refused in:\n%s\ngot %v", bad, content, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PinFileName is the name of the file that pins a persona for a project
+const PinFileName = ".agents-persona"
+
+// Pin is the persona a project is pinned to
+type Pin struct {
+	Persona string
+	// Path is the pin file (or .agents.yaml) the pin was read from
+	Path string
+	// Dir is the project directory
+	Dir string
+}
+
+// FindPin walks up from dir looking for a pinned persona: a .agents-persona file, or the
+// persona field of a .agents.yaml. In the same directory .agents-persona wins.
+// It returns nil if no pin is found.
+func FindPin(dir string) (*Pin, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		pinPath := filepath.Join(dir, PinFileName)
+		persona, err := readPinFile(pinPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if persona != "" {
+			return &Pin{Persona: persona, Path: pinPath, Dir: dir}, nil
+		}
+
+		projectPath := filepath.Join(dir, ProjectConfigName)
+		if _, err := os.Stat(projectPath); err == nil {
+			pc, err := LoadProjectConfig(projectPath)
+			if err != nil {
+				return nil, err
+			}
+			if pc.Persona != "" {
+				return &Pin{Persona: pc.Persona, Path: projectPath, Dir: dir}, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Hash returns a hash of the files that configure the pinned project (its .agents-persona and
+// .agents.yaml), so that a project allowed for the shell hook can be told from one changed since
+func (p *Pin) Hash() (string, error) {
+	h := sha256.New()
+	for _, name := range []string{PinFileName, ProjectConfigName} {
+		data, err := os.ReadFile(filepath.Join(p.Dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(h, "%s -\n", name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", name, len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readPinFile returns the first line of a pin file that is neither empty nor a # comment
+func readPinFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(line, " \t/") {
+			return "", fmt.Errorf("%s: invalid persona name %q", path, line)
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("%s: no persona named", path)
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ProjectConfigName is the name of the project-scoped configuration file
+const ProjectConfigName = ".agents.yaml"
+
+// ProjectConfig is the configuration of a project, layered on top of the user config
+type ProjectConfig struct {
+	// Path is the .agents.yaml the configuration was read from
+	Path      string            `mapstructure:"-"`
+	AgentsDir []string          `mapstructure:"agents_dir"`
+	Targets   []TargetConfig    `mapstructure:"targets"`
+	Vars      map[string]string `mapstructure:"vars"`
+	// Persona is used by `agents use` when no persona is given
+	Persona string `mapstructure:"persona"`
+	// Branches are tried before those of the user config
+	Branches []BranchRule `mapstructure:"branches"`
+}
+
+// FindProjectConfig walks up from dir looking for a .agents.yaml.
+// It returns "" if there is none.
+func FindProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigName)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectConfig reads a .agents.yaml.
+// Persona directories and target paths are resolved against the directory of the file, and must stay inside it.
+func LoadProjectConfig(path string) (*ProjectConfig, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	pc := &ProjectConfig{}
+	if err := v.Unmarshal(pc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	pc.Path = path
+
+	base := filepath.Dir(path)
+	for i, dir := range pc.AgentsDir {
+		resolved, err := resolveProjectPath(base, dir)
+		if err != nil {
+			return nil, fmt.Errorf("error in %s: agents_dir: %w", path, err)
+		}
+		pc.AgentsDir[i] = resolved
+	}
+	for i := range pc.Targets {
+		resolved, err := resolveProjectPath(base, pc.Targets[i].Path)
+		if err != nil {
+			return nil, fmt.Errorf("error in %s: targets: %w", path, err)
+		}
+		pc.Targets[i].Path = resolved
+	}
+	return pc, nil
+}
+
+// resolveProjectPath makes path absolute relative to base, the project directory.
+// A .agents.yaml comes with the repository, so its paths may not leave the project:
+// absolute, ~ and .. paths are refused.
+func resolveProjectPath(base, path string) (string, error) {
+	if path == "" {
+		return path, nil
+	}
+	if filepath.IsAbs(path) || path == "~" || strings.HasPrefix(path, "~/") {
+		return "", fmt.Errorf("%q must be a relative path inside the project", path)
+	}
+	resolved := filepath.Join(base, path)
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q must be a relative path inside the project", path)
+	}
+	return resolved, nil
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 // TargetMode defines how the persona is applied to the target
 type TargetMode string
 
@@ -10,8 +12,20 @@ const (
 
 // TargetConfig represents a single target in the configuration
 type TargetConfig struct {
-	Path string     `mapstructure:"path"`
-	Mode TargetMode `mapstructure:"mode"`
+	Path   string     `mapstructure:"path"`
+	Mode   TargetMode `mapstructure:"mode"`
+	Render bool       `mapstructure:"render"` // Link mode only: link to a rendered copy with includes expanded
+	Marker bool       `mapstructure:"marker"` // Copy mode only: start the copy with an ownership comment
+	// Variants map an active persona to the persona this target gets instead (e.g. coder: gemini-coder)
+	Variants map[string]string `mapstructure:"variants"`
+}
+
+// PersonaFor returns the persona applied to the target while persona is active
+func (t TargetConfig) PersonaFor(persona string) string {
+	if variant := t.Variants[persona]; variant != "" {
+		return variant
+	}
+	return persona
 }
 
 // Config represents the top-level configuration
@@ -19,4 +33,36 @@ type Config struct {
 	AgentsDir  []string       `mapstructure:"agents_dir" yaml:"agents_dir"`
 	TargetFile string         `mapstructure:"target_file" yaml:"target_file"` // Legacy support
 	Targets    []TargetConfig `mapstructure:"targets" yaml:"targets"`
+	// Vars are available to persona templates as {{ .Vars.<name> }}
+	Vars map[string]string `mapstructure:"vars" yaml:"vars"`
+	// Rules choose a persona for `agents auto`; the first matching rule wins
+	Rules []Rule `mapstructure:"rules" yaml:"rules"`
+	// Branches choose a persona from the git hooks installed by `agents git install-hooks`
+	Branches []BranchRule `mapstructure:"branches" yaml:"branches"`
+	// JournalRetention is the number of unuse/drop commands kept for `agents undo`; 0 disables the journal
+	JournalRetention int `mapstructure:"journal_retention" yaml:"journal_retention"`
+	// WatchInterval is how often `agents watch` polls for changes
+	WatchInterval time.Duration `mapstructure:"watch_interval" yaml:"watch_interval"`
+}
+
+// BranchRule selects a persona for git branches matching Pattern (a glob, e.g. "docs/*")
+type BranchRule struct {
+	Pattern string `mapstructure:"pattern" yaml:"pattern"`
+	Persona string `mapstructure:"persona" yaml:"persona"`
+}
+
+// Rule selects a persona when all of its conditions match. Empty conditions always match.
+type Rule struct {
+	Name    string `mapstructure:"name" yaml:"name"`
+	Persona string `mapstructure:"persona" yaml:"persona"`
+	// Dir is a glob matched against the working directory; a trailing /** also matches subdirectories
+	Dir string `mapstructure:"dir" yaml:"dir"`
+	// Branch is a glob matched against the current git branch
+	Branch string `mapstructure:"branch" yaml:"branch"`
+	// Host is a glob matched against the hostname
+	Host string `mapstructure:"host" yaml:"host"`
+	// Env is NAME (set and non-empty) or NAME=glob
+	Env string `mapstructure:"env" yaml:"env"`
+	// Time is a local time window HH:MM-HH:MM, which may wrap past midnight
+	Time string `mapstructure:"time" yaml:"time"`
 }
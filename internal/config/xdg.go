@@ -63,3 +63,23 @@ func GetStateHome() (string, error) {
 	}
 	return filepath.Join(home, ".local", "state"), nil
 }
+
+// GetCacheHome returns the XDG_CACHE_HOME or platform default.
+// On Windows: %LOCALAPPDATA%
+// On Unix: ~/.cache
+func GetCacheHome() (string, error) {
+	if xdgCacheHome := os.Getenv("XDG_CACHE_HOME"); xdgCacheHome != "" {
+		return xdgCacheHome, nil
+	}
+	if runtime.GOOS == "windows" {
+		if localAppData := os.Getenv("LOCALAPPDATA"); localAppData != "" {
+			return localAppData, nil
+		}
+		return os.UserCacheDir()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache"), nil
+}
@@ -1,152 +1,401 @@
 package ops
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"agent-smith/internal/config"
 )
 
+// ApplyOptions customizes how a persona is applied
+type ApplyOptions struct {
+	// Vars are exposed to persona templates as .Vars
+	Vars map[string]string
+	// Out receives progress messages (default os.Stdout)
+	Out io.Writer
+	// BestEffort keeps going after a target fails instead of rolling every target back
+	BestEffort bool
+}
+
+// ApplyResult describes what happened when a persona was applied
+type ApplyResult struct {
+	AgentPath string
+	Targets   []TargetResult
+}
+
+// TargetResult is the outcome of applying a persona to a single target
+type TargetResult struct {
+	Target config.TargetConfig
+	// Path is the expanded target path
+	Path string
+	// LinkDest is the symlink destination for link targets
+	LinkDest string
+	// Hash is the SHA-256 of the content written (copy and rendered link targets)
+	Hash string
+	// Variant is the persona applied to this target when its variants replace the active persona
+	Variant string
+	// SourceHash is the SHA-256 of the resolved persona the content was rendered from
+	SourceHash string
+	// SourceModTime is the latest modification time of the persona files it was rendered from
+	SourceModTime time.Time
+	// Unchanged is set when the target already was as the persona would write it, so nothing was written
+	Unchanged bool
+	// RolledBack is set when the target was restored to its previous state after another target failed
+	RolledBack bool
+	Err        error
+}
+
 // ApplyPersona applies the given persona to the specified targets
 func ApplyPersona(persona string, agentsDirs []string, targets []config.TargetConfig) (string, error) {
-	agentFileName := fmt.Sprintf("AGENTS.%s.md", persona)
-	var agentPath string
-	found := false
+	result, err := ApplyPersonaWithOptions(persona, agentsDirs, targets, ApplyOptions{})
+	return result.AgentPath, err
+}
 
-	for _, dir := range agentsDirs {
-		candidate := filepath.Join(dir, agentFileName)
-		if _, err := os.Stat(candidate); err == nil {
-			agentPath = candidate
-			found = true
-			break
-		}
+// ApplyPersonaWithOptions applies the given persona to the specified targets.
+// Unless opts.BestEffort is set the apply is all-or-nothing: every target is snapshotted before it is
+// written, and if any target fails all targets written so far are restored.
+// The returned result is never nil; it lists every target that was attempted.
+func ApplyPersonaWithOptions(persona string, agentsDirs []string, targets []config.TargetConfig, opts ApplyOptions) (*ApplyResult, error) {
+	out := opts.Out
+	if out == nil {
+		out = os.Stdout
 	}
+	result := &ApplyResult{}
 
-	if !found {
-		fmt.Printf("Error: Persona '%s' not found.\n", persona)
-		fmt.Printf("Searched in:\n")
+	agentPath, err := FindPersona(persona, agentsDirs)
+	if err != nil {
+		fmt.Fprintf(out, "Error: Persona '%s' not found.\n", persona)
+		fmt.Fprintf(out, "Searched in:\n")
 		for _, dir := range agentsDirs {
-			fmt.Printf("  - %s\n", dir)
+			fmt.Fprintf(out, "  - %s\n", dir)
 		}
-		return "", fmt.Errorf("persona not found")
+		return result, err
 	}
+	result.AgentPath = agentPath
 
-	// Read persona content once if needed for copy
-	var personaContent []byte
+	// Personas are loaded once, the variants of targets on first use
+	personas := newPersonaSet(persona, agentPath, agentsDirs)
 	var applyErrors []error
 
+	// Snapshots of everything touched so far, per target (transactional mode)
+	var snapshots [][]*snapshot
+	fatal := func(err error) (*ApplyResult, error) {
+		fmt.Fprintln(out, err)
+		if opts.BestEffort {
+			return result, err
+		}
+		if rbErr := rollback(out, result, snapshots); rbErr != nil {
+			return result, fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return result, err
+	}
+
 	// Iterate over targets
 	for _, target := range targets {
-		// Check if target directory exists
 		targetPath := ExpandPath(target.Path)
-		dir := filepath.Dir(targetPath)
+		tr := TargetResult{Target: target, Path: targetPath}
 
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			err = fmt.Errorf("error creating target directory %s: %w", dir, err)
-			fmt.Println(err)
-			applyErrors = append(applyErrors, err)
-			continue
+		targetPersona := target.PersonaFor(persona)
+		targetAgentPath, err := personas.path(targetPersona)
+		if err != nil {
+			return fatal(fmt.Errorf("%s: variant of '%s': %w", targetPath, persona, err))
+		}
+		if targetPersona != persona {
+			tr.Variant = targetPersona
 		}
 
-		// Perform Action
-		if target.Mode == config.TargetModeCopy {
-			// Lazy load content
-			if personaContent == nil {
-				content, err := os.ReadFile(agentPath)
-				if err != nil {
-					err = fmt.Errorf("error reading persona file %s: %w", agentPath, err)
-					fmt.Println(err)
-					return "", err
-				}
-				personaContent = content
-			}
+		// Copies and composed personas are rendered; other links point at the persona file
+		loaded, personaContent, rendered, err := personas.render(targetPersona, target, opts.Vars)
+		if err != nil {
+			return fatal(err)
+		}
 
-			// Atomic Copy
-			tmpFile, err := os.CreateTemp(dir, "agents-tmp-*")
+		if !opts.BestEffort {
+			snaps, err := snapshotTarget(targetPersona, target, rendered)
 			if err != nil {
-				err = fmt.Errorf("error creating temp file for %s: %w", targetPath, err)
-				fmt.Println(err)
-				applyErrors = append(applyErrors, err)
-				continue
-			}
-			tmpName := tmpFile.Name()
-
-			if _, err := tmpFile.Write(personaContent); err != nil {
-				err = fmt.Errorf("error writing to temp file: %w", err)
-				fmt.Println(err)
-				tmpFile.Close()
-				os.Remove(tmpName)
-				applyErrors = append(applyErrors, err)
-				continue
-			}
-			if err := tmpFile.Close(); err != nil {
-				err = fmt.Errorf("error closing temp file: %w", err)
-				fmt.Println(err)
-				os.Remove(tmpName)
-				applyErrors = append(applyErrors, err)
-				continue
+				return fatal(err)
 			}
+			snapshots = append(snapshots, snaps)
+		}
 
-			// Rename (Atomic replace)
-			if err := os.Rename(tmpName, targetPath); err != nil {
-				err = fmt.Errorf("error renaming to %s: %w", targetPath, err)
-				fmt.Println(err)
-				os.Remove(tmpName)
-				applyErrors = append(applyErrors, err)
-				continue
-			}
+		linkDest, unchanged, err := applyTarget(out, targetPersona, targetAgentPath, target, personaContent)
+		tr.LinkDest = linkDest
+		tr.Unchanged = unchanged
+		tr.Err = err
+		if rendered && err == nil {
+			tr.Hash = HashContent(personaContent)
+			tr.SourceHash = HashContent(loaded.Content)
+			tr.SourceModTime = loaded.SourceModTime()
+		}
+		result.Targets = append(result.Targets, tr)
 
-			// Fix permissions (os.CreateTemp creates 0600)
-			if err := os.Chmod(targetPath, 0644); err != nil {
-				// Warn but don't fail hard? Or fail? Best to warn.
-				// However, if we want strict correctness, we might log it.
-				// For now let's just log and continue, or maybe append error?
-				// The prompt suggested strict fix. I'll append error but maybe not block?
-				// Actually, if chmod fails, it's not ideal.
-				// Let's just append to applyErrors for correctness.
-				// But wait, the file IS updated.
-				fmt.Printf("Warning: failed to chmod %s: %v\n", targetPath, err)
+		if err != nil {
+			if !opts.BestEffort {
+				return fatal(fmt.Errorf("failed to apply targets: %w", err))
 			}
+			fmt.Fprintln(out, err)
+			applyErrors = append(applyErrors, err)
+			continue
+		}
 
-			fmt.Printf("Updated (copy): %s\n", targetPath)
-
+		variant := ""
+		if tr.Variant != "" {
+			variant = fmt.Sprintf(" (%s)", tr.Variant)
+		}
+		if unchanged {
+			fmt.Fprintf(out, "Unchanged: %s%s\n", targetPath, variant)
+		} else if target.Mode == config.TargetModeCopy {
+			fmt.Fprintf(out, "Updated (copy): %s%s\n", targetPath, variant)
+		} else if rendered {
+			// The link points at a generated copy, not the persona file; say so since edits to the persona need a reconcile
+			fmt.Fprintf(out, "Updated (rendered link): %s%s -> %s\n", targetPath, variant, linkDest)
 		} else {
-			// Link Mode (Default)
-			// Remove existing
-			if _, err := os.Lstat(targetPath); err == nil {
-				if err := os.Remove(targetPath); err != nil {
-					err = fmt.Errorf("error removing existing %s: %w", targetPath, err)
-					fmt.Println(err)
-					applyErrors = append(applyErrors, err)
-					continue
-				}
+			fmt.Fprintf(out, "Updated (link): %s%s\n", targetPath, variant)
+		}
+	}
+
+	if len(applyErrors) > 0 {
+		return result, fmt.Errorf("failed to apply targets: %v", applyErrors)
+	}
+
+	return result, nil
+}
+
+// personaSet finds and loads the personas of one apply on demand: the active persona and the variants of its targets
+type personaSet struct {
+	agentsDirs []string
+	paths      map[string]string
+	loaded     map[string]*Persona
+}
+
+func newPersonaSet(persona, agentPath string, agentsDirs []string) *personaSet {
+	return &personaSet{
+		agentsDirs: agentsDirs,
+		paths:      map[string]string{persona: agentPath},
+		loaded:     make(map[string]*Persona),
+	}
+}
+
+// path returns the persona file of name
+func (s *personaSet) path(name string) (string, error) {
+	if p, ok := s.paths[name]; ok {
+		return p, nil
+	}
+	p, err := FindPersona(name, s.agentsDirs)
+	if err != nil {
+		return "", fmt.Errorf("persona '%s' not found", name)
+	}
+	s.paths[name] = p
+	return p, nil
+}
+
+// load returns name with its includes and inheritance resolved
+func (s *personaSet) load(name string) (*Persona, error) {
+	if p, ok := s.loaded[name]; ok {
+		return p, nil
+	}
+	p, err := LoadPersona(name, s.agentsDirs)
+	if err != nil {
+		return nil, err
+	}
+	s.loaded[name] = p
+	return p, nil
+}
+
+// render returns the content target gets from persona name and whether that content is written:
+// always for copies, and for links when asked to (render: true) or when the persona file is not the
+// persona as it renders (frontmatter, includes, extends or templates). Other links point at the
+// persona file itself and get no content.
+func (s *personaSet) render(name string, target config.TargetConfig, vars map[string]string) (*Persona, []byte, bool, error) {
+	loaded, err := s.load(name)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	content, err := RenderTemplate(loaded, NewTemplateData(name, target, vars))
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("%s: %w", loaded.Path, err)
+	}
+
+	if target.Mode == config.TargetModeCopy {
+		if target.Marker {
+			content = AddMarker(name, content)
+		}
+		return loaded, content, true, nil
+	}
+	if !target.Render {
+		if raw, err := os.ReadFile(loaded.Path); err == nil && bytes.Equal(raw, content) {
+			return loaded, nil, false, nil
+		}
+	}
+	return loaded, content, true, nil
+}
+
+// RenderedLink reports whether a link target of persona points at a rendered copy rather
+// than at the persona file
+func RenderedLink(persona string, agentsDirs []string, target config.TargetConfig, vars map[string]string) (bool, error) {
+	personas := &personaSet{agentsDirs: agentsDirs, paths: make(map[string]string), loaded: make(map[string]*Persona)}
+	_, _, rendered, err := personas.render(persona, target, vars)
+	return rendered, err
+}
+
+// snapshotTarget records every path applying target may change (the target and its rendered copy)
+func snapshotTarget(persona string, target config.TargetConfig, rendered bool) ([]*snapshot, error) {
+	targetPath := ExpandPath(target.Path)
+	paths := []string{targetPath}
+	if target.Mode != config.TargetModeCopy && rendered {
+		if cachePath, err := RenderedPath(persona, targetPath); err == nil {
+			paths = append(paths, cachePath)
+		}
+	}
+
+	var snaps []*snapshot
+	for _, path := range paths {
+		s, err := takeSnapshot(path)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, s)
+	}
+	return snaps, nil
+}
+
+// rollback restores the snapshotted targets in reverse order and marks them in the result
+func rollback(out io.Writer, result *ApplyResult, snapshots [][]*snapshot) error {
+	var errs []error
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		restored := true
+		for _, s := range snapshots[i] {
+			if err := s.restore(); err != nil {
+				fmt.Fprintln(out, err)
+				errs = append(errs, err)
+				restored = false
 			}
+		}
+		if restored && i < len(result.Targets) {
+			result.Targets[i].RolledBack = true
+			fmt.Fprintf(out, "Rolled back: %s\n", result.Targets[i].Path)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
 
-			absAgentPath, err := filepath.Abs(agentPath)
-			if err != nil {
-				absAgentPath = agentPath
+// applyTarget writes a single target. content is the rendered persona for copy and rendered link targets,
+// nil for links to the persona file. It returns the symlink destination for link targets.
+// Files and links that are already as they should be are not rewritten, so a reconcile with nothing
+// to change writes nothing; unchanged reports that nothing was written.
+func applyTarget(out io.Writer, persona, agentPath string, target config.TargetConfig, content []byte) (linkDest string, unchanged bool, err error) {
+	// Check if target directory exists
+	targetPath := ExpandPath(target.Path)
+	dir := filepath.Dir(targetPath)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, fmt.Errorf("error creating target directory %s: %w", dir, err)
+	}
+
+	if target.Mode == config.TargetModeCopy {
+		if hasContent(targetPath, content) {
+			return "", true, nil
+		}
+		return "", false, writeFileAtomic(out, targetPath, content)
+	}
+
+	// Link Mode (Default)
+	linkDest = agentPath
+	renderedUnchanged := true
+	if content != nil {
+		// Link to a rendered copy so frontmatter, includes and inheritance are resolved for link targets too
+		cachePath, err := RenderedPath(persona, targetPath)
+		if err != nil {
+			return "", false, fmt.Errorf("error locating rendered copy: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+			return "", false, fmt.Errorf("error creating rendered copy directory: %w", err)
+		}
+		if !hasContent(cachePath, content) {
+			renderedUnchanged = false
+			if err := writeFileAtomic(out, cachePath, content); err != nil {
+				return "", false, err
 			}
+		}
+		linkDest = cachePath
+	}
+
+	absLinkDest, err := filepath.Abs(linkDest)
+	if err != nil {
+		absLinkDest = linkDest
+	}
 
-			if err := os.Symlink(absAgentPath, targetPath); err != nil {
-				// Enhance error message for Windows users
-				if runtime.GOOS == "windows" {
-					err = fmt.Errorf("error creating symlink %s (on Windows, ensure Developer Mode is enabled or run as Administrator): %w", targetPath, err)
-				} else {
-					err = fmt.Errorf("error creating symlink %s: %w", targetPath, err)
-				}
-				fmt.Println(err)
-				applyErrors = append(applyErrors, err)
-				continue
+	// Remove existing, unless it is the link already
+	if info, err := os.Lstat(targetPath); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			if current, err := os.Readlink(targetPath); err == nil && filepath.Clean(current) == filepath.Clean(absLinkDest) {
+				return absLinkDest, renderedUnchanged, nil
 			}
-			fmt.Printf("Updated (link): %s\n", targetPath)
+		}
+		if err := os.Remove(targetPath); err != nil {
+			return "", false, fmt.Errorf("error removing existing %s: %w", targetPath, err)
 		}
 	}
 
-	if len(applyErrors) > 0 {
-		return agentPath, fmt.Errorf("failed to apply targets: %v", applyErrors)
+	if err := os.Symlink(absLinkDest, targetPath); err != nil {
+		// Enhance error message for Windows users
+		if runtime.GOOS == "windows" {
+			return "", false, fmt.Errorf("error creating symlink %s (on Windows, ensure Developer Mode is enabled or run as Administrator): %w", targetPath, err)
+		}
+		return "", false, fmt.Errorf("error creating symlink %s: %w", targetPath, err)
+	}
+
+	return absLinkDest, false, nil
+}
+
+// hasContent reports whether path is a regular file holding exactly content
+func hasContent(path string, content []byte) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	current, err := os.ReadFile(path)
+	return err == nil && bytes.Equal(current, content)
+}
+
+// writeFileAtomic writes content next to path and renames it into place
+func writeFileAtomic(out io.Writer, path string, content []byte) error {
+	dir := filepath.Dir(path)
+
+	tmpFile, err := os.CreateTemp(dir, "agents-tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file for %s: %w", path, err)
+	}
+	tmpName := tmpFile.Name()
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("error writing to temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("error closing temp file: %w", err)
+	}
+
+	// Rename (Atomic replace)
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("error renaming to %s: %w", path, err)
+	}
+
+	// Fix permissions (os.CreateTemp creates 0600)
+	if err := os.Chmod(path, 0644); err != nil {
+		fmt.Fprintf(out, "Warning: failed to chmod %s: %v\n", path, err)
 	}
 
-	return agentPath, nil
+	return nil
 }
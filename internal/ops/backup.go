@@ -0,0 +1,98 @@
+package ops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BackupFile moves the file (or symlink) at path into a new directory under backupRoot.
+// It returns the location of the backup.
+func BackupFile(path, backupRoot string) (string, error) {
+	absPath, err := filepath.Abs(ExpandPath(path))
+	if err != nil {
+		absPath = ExpandPath(path)
+	}
+
+	// One directory per backup: timestamp plus a short key of the original path
+	sum := sha256.Sum256([]byte(absPath))
+	name := fmt.Sprintf("%s-%s", time.Now().Format("20060102-150405.000000000"), hex.EncodeToString(sum[:])[:8])
+	dir := filepath.Join(backupRoot, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating backup directory: %w", err)
+	}
+
+	backupPath := filepath.Join(dir, filepath.Base(absPath))
+	if err := moveFile(absPath, backupPath); err != nil {
+		os.Remove(dir)
+		return "", fmt.Errorf("error backing up %s: %w", absPath, err)
+	}
+	return backupPath, nil
+}
+
+// RestoreFile moves a backup made by BackupFile back to path.
+// It fails if something already exists at path.
+func RestoreFile(backupPath, path string) error {
+	path = ExpandPath(path)
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", path, err)
+	}
+	if err := moveFile(backupPath, path); err != nil {
+		return fmt.Errorf("error restoring %s: %w", path, err)
+	}
+	// Remove the per-backup directory if it is now empty
+	os.Remove(filepath.Dir(backupPath))
+	return nil
+}
+
+// moveFile renames src to dst, copying across filesystems when needed.
+// Symlinks are moved as links.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(dest, dst); err != nil {
+			return err
+		}
+		return os.Remove(src)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
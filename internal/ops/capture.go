@@ -0,0 +1,54 @@
+package ops
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// PersonaBody returns the content of a persona file without its frontmatter
+func PersonaBody(agentPath string) ([]byte, error) {
+	raw, err := os.ReadFile(agentPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading persona file %s: %w", agentPath, err)
+	}
+	_, body, err := SplitFrontmatter(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", agentPath, err)
+	}
+	return body, nil
+}
+
+// CapturePersona replaces the body of the persona file at agentPath with content.
+// The frontmatter and file permissions are kept; symlinked persona files are written through.
+func CapturePersona(agentPath string, content []byte) error {
+	realPath, err := filepath.EvalSymlinks(agentPath)
+	if err != nil {
+		return fmt.Errorf("error resolving persona file %s: %w", agentPath, err)
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return fmt.Errorf("error reading persona file %s: %w", realPath, err)
+	}
+	raw, err := os.ReadFile(realPath)
+	if err != nil {
+		return fmt.Errorf("error reading persona file %s: %w", realPath, err)
+	}
+	_, body, err := SplitFrontmatter(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", realPath, err)
+	}
+
+	header := raw[:len(raw)-len(body)]
+	updated := append(append([]byte{}, header...), content...)
+
+	if err := writeFileAtomic(io.Discard, realPath, updated); err != nil {
+		return err
+	}
+	if err := os.Chmod(realPath, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error restoring permissions of %s: %w", realPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package ops
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// maxDiffEdits bounds the edit script searched for; files further apart are shown as a whole-file replace
+const maxDiffEdits = 1000
+
+// diffEdit is a single line of an edit script. text keeps its line ending, so a last line
+// without one differs from the same line with one.
+// aPos and bPos are the number of lines of a and b consumed before this line.
+type diffEdit struct {
+	op   byte // ' ', '-' or '+'
+	text string
+	aPos int
+	bPos int
+}
+
+// UnifiedDiff returns a unified diff turning a into b, or "" if they are equal
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	aLines := splitLines(string(a))
+	bLines := splitLines(string(b))
+
+	edits := diffLines(aLines, bLines)
+
+	var sb strings.Builder
+	i := 0
+	for i < len(edits) {
+		// Find the next change
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		end := i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			j := end
+			for j < len(edits) && edits[j].op == ' ' {
+				j++
+			}
+			if j == len(edits) || j-end > 2*diffContext {
+				end += diffContext
+				if end > len(edits) {
+					end = len(edits)
+				}
+				break
+			}
+			end = j
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+		}
+		writeHunk(&sb, edits[start:end])
+		i = end
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, hunk []diffEdit) {
+	aCount, bCount := 0, 0
+	for _, e := range hunk {
+		if e.op != '+' {
+			aCount++
+		}
+		if e.op != '-' {
+			bCount++
+		}
+	}
+
+	aStart := hunk[0].aPos
+	if aCount > 0 {
+		aStart++
+	}
+	bStart := hunk[0].bPos
+	if bCount > 0 {
+		bStart++
+	}
+
+	fmt.Fprintf(sb, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, e := range hunk {
+		sb.WriteByte(e.op)
+		sb.WriteString(e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// diffLines computes a shortest edit script using the Myers algorithm.
+// Only the diagonals reachable at each step are traced, so memory grows with the square of the
+// edit distance, which is capped at maxDiffEdits.
+func diffLines(a, b []string) []diffEdit {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d..d] as it was before step d
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		if d > maxDiffEdits {
+			return replaceLines(a, b)
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// Backtrack from the end to recover the edit script (built in reverse)
+	var reversed []diffEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		vd := trace[d]
+		k := x - y
+
+		// Step 0 is the snake from the origin
+		prevX, prevY := 0, 0
+		if d > 0 {
+			var prevK int
+			if k == -d || (k != d && vd[d+k-1] < vd[d+k+1]) {
+				prevK = k + 1
+			} else {
+				prevK = k - 1
+			}
+			prevX = vd[d+prevK]
+			prevY = prevX - prevK
+		}
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffEdit{op: ' ', text: a[x], aPos: x, bPos: y})
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffEdit{op: '+', text: b[prevY], aPos: prevX, bPos: prevY})
+			} else {
+				reversed = append(reversed, diffEdit{op: '-', text: a[prevX], aPos: prevX, bPos: prevY})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	edits := make([]diffEdit, len(reversed))
+	for i, e := range reversed {
+		edits[len(reversed)-1-i] = e
+	}
+	return edits
+}
+
+// replaceLines is the edit script removing every line of a and adding every line of b
+func replaceLines(a, b []string) []diffEdit {
+	edits := make([]diffEdit, 0, len(a)+len(b))
+	for i, line := range a {
+		edits = append(edits, diffEdit{op: '-', text: line, aPos: i})
+	}
+	for j, line := range b {
+		edits = append(edits, diffEdit{op: '+', text: line, aPos: len(a), bPos: j})
+	}
+	return edits
+}
+
+// splitLines splits s after each newline; the last line has none if s does not end with one
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,106 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Frontmatter is the optional YAML header of a persona file
+type Frontmatter struct {
+	Description string     `yaml:"description"`
+	Tags        StringList `yaml:"tags"`
+	Author      string     `yaml:"author"`
+	Version     string     `yaml:"version"`
+	// Targets lists paths this persona is recommended for
+	Targets StringList `yaml:"targets"`
+	Extends StringList `yaml:"extends"`
+	// Template enables Go template rendering when set to true
+	Template *bool `yaml:"template"`
+}
+
+// HasTag reports whether the frontmatter lists tag (case-insensitive)
+func (f Frontmatter) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// StringList accepts either a single string or a list of strings
+type StringList []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (l *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if node.Value == "" {
+			*l = nil
+			return nil
+		}
+		*l = StringList{node.Value}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// SplitFrontmatter separates a leading `---` delimited YAML block from the document body.
+// Content without frontmatter is returned unchanged.
+func SplitFrontmatter(content []byte) (Frontmatter, []byte, error) {
+	var fm Frontmatter
+
+	rest, ok := cutLine(content, "---")
+	if !ok {
+		return fm, content, nil
+	}
+
+	// Find the closing delimiter
+	offset := 0
+	for {
+		line, next := nextLine(rest[offset:])
+		trimmed := string(bytes.TrimRight(line, "\r"))
+		if trimmed == "---" || trimmed == "..." {
+			if err := yaml.Unmarshal(rest[:offset], &fm); err != nil {
+				return fm, content, fmt.Errorf("invalid frontmatter: %w", err)
+			}
+			if next == 0 {
+				return fm, nil, nil
+			}
+			return fm, rest[offset+next:], nil
+		}
+		if next == 0 {
+			break
+		}
+		offset += next
+	}
+
+	// No closing delimiter: treat the document as having no frontmatter
+	return Frontmatter{}, content, nil
+}
+
+// cutLine returns the content after the first line if that line equals want
+func cutLine(content []byte, want string) ([]byte, bool) {
+	line, next := nextLine(content)
+	if next == 0 || string(bytes.TrimRight(line, "\r")) != want {
+		return nil, false
+	}
+	return content[next:], true
+}
+
+// nextLine returns the first line (without newline) and the offset of the following line.
+// The offset is 0 when content has no newline.
+func nextLine(content []byte) ([]byte, int) {
+	i := bytes.IndexByte(content, '\n')
+	if i < 0 {
+		return content, 0
+	}
+	return content[:i], i + 1
+}
@@ -0,0 +1,218 @@
+package ops
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"agent-smith/internal/config"
+)
+
+// GitHookMarker identifies git hooks installed by agent-smith
+const GitHookMarker = "# Installed by agent-smith (agents git install-hooks)"
+
+// chainedHookSuffix is appended to a hook that existed before ours; our hook runs it first
+const chainedHookSuffix = ".pre-agents"
+
+// GitRepo describes the git repository containing a directory.
+// It is read from the .git directory so it does not depend on a git binary.
+type GitRepo struct {
+	// Root is the top of the working tree
+	Root string
+	// Dir is the git directory of the working tree (.git, or .git/worktrees/<name> for linked worktrees)
+	Dir string
+	// CommonDir is the git directory shared by all worktrees (holds config and hooks)
+	CommonDir string
+}
+
+// FindGitRepo walks up from dir to the repository containing it.
+// It returns nil if dir is not inside a git working tree.
+func FindGitRepo(dir string) (*GitRepo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		gitPath := filepath.Join(d, ".git")
+		info, err := os.Stat(gitPath)
+		if err == nil {
+			repo := &GitRepo{Root: d, Dir: gitPath}
+			if !info.IsDir() {
+				// Worktrees and submodules: "gitdir: <path>"
+				data, err := os.ReadFile(gitPath)
+				if err != nil {
+					return nil, err
+				}
+				target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+				if !ok {
+					return nil, fmt.Errorf("%s is not a git directory", gitPath)
+				}
+				if !filepath.IsAbs(target) {
+					target = filepath.Join(d, target)
+				}
+				repo.Dir = target
+			}
+			repo.CommonDir = repo.Dir
+			if data, err := os.ReadFile(filepath.Join(repo.Dir, "commondir")); err == nil {
+				common := strings.TrimSpace(string(data))
+				if !filepath.IsAbs(common) {
+					common = filepath.Join(repo.Dir, common)
+				}
+				repo.CommonDir = filepath.Clean(common)
+			}
+			return repo, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if filepath.Dir(d) == d {
+			return nil, nil
+		}
+	}
+}
+
+// Branch returns the checked out branch, or "" on a detached HEAD
+func (r *GitRepo) Branch() string {
+	head, err := os.ReadFile(filepath.Join(r.Dir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	// A detached HEAD holds a commit id instead of a ref
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+	if !ok {
+		return ""
+	}
+	return branch
+}
+
+// HooksDir returns the directory git runs hooks from, honouring core.hooksPath
+func (r *GitRepo) HooksDir() string {
+	if hooksPath := r.configValue("core", "hookspath"); hooksPath != "" {
+		hooksPath = ExpandPath(hooksPath)
+		if !filepath.IsAbs(hooksPath) {
+			hooksPath = filepath.Join(r.Root, hooksPath)
+		}
+		return hooksPath
+	}
+	return filepath.Join(r.CommonDir, "hooks")
+}
+
+// configValue reads a key from the repository's config file (no includes, last value wins)
+func (r *GitRepo) configValue(section, key string) string {
+	data, err := os.ReadFile(filepath.Join(r.CommonDir, "config"))
+	if err != nil {
+		return ""
+	}
+	var current, value string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			// An empty section header is invalid; skip it rather than guess a section
+			fields := strings.Fields(strings.Trim(line, "[]"))
+			if len(fields) == 0 {
+				current = ""
+				continue
+			}
+			current = strings.ToLower(strings.Trim(fields[0], "\""))
+			continue
+		}
+		k, v, _ := strings.Cut(line, "=")
+		if current == section && strings.EqualFold(strings.TrimSpace(k), key) {
+			value = strings.Trim(strings.TrimSpace(v), "\"")
+		}
+	}
+	return value
+}
+
+// GitBranch returns the branch checked out in the git repository containing dir, or "" if none
+func GitBranch(dir string) string {
+	repo, err := FindGitRepo(dir)
+	if err != nil || repo == nil {
+		return ""
+	}
+	return repo.Branch()
+}
+
+// BranchPersona returns the first rule whose pattern matches branch
+func BranchPersona(rules []config.BranchRule, branch string) (config.BranchRule, bool) {
+	if branch == "" {
+		return config.BranchRule{}, false
+	}
+	for _, r := range rules {
+		if ok, _ := filepath.Match(r.Pattern, branch); ok {
+			return r, true
+		}
+	}
+	return config.BranchRule{}, false
+}
+
+// IsAgentsGitHook reports whether the hook at path was installed by agent-smith
+func IsAgentsGitHook(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(data, []byte(GitHookMarker))
+}
+
+// ChainedGitHook is where a hook that existed before ours is kept
+func ChainedGitHook(path string) string {
+	return path + chainedHookSuffix
+}
+
+// InstallGitHook writes script as the hook at path. A hook that is not ours is kept
+// next to it (see ChainedGitHook) for our script to run; chained reports whether that happened.
+// Installing over our own hook replaces it.
+func InstallGitHook(path, script string) (chained bool, err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if _, err := os.Lstat(path); err == nil && !IsAgentsGitHook(path) {
+		orig := ChainedGitHook(path)
+		if _, err := os.Lstat(orig); err == nil {
+			return false, fmt.Errorf("cannot chain %s: %s already exists", path, orig)
+		}
+		if err := os.Rename(path, orig); err != nil {
+			return false, err
+		}
+		chained = true
+	}
+	if err := writeFileAtomic(io.Discard, path, []byte(script)); err != nil {
+		return chained, err
+	}
+	return chained, os.Chmod(path, 0755)
+}
+
+// UninstallGitHook removes our hook at path and puts back the hook it chained to, if any.
+// A hook at path that is not ours is left alone.
+func UninstallGitHook(path string) (removed, restored bool, err error) {
+	if _, err := os.Lstat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	if !IsAgentsGitHook(path) {
+		return false, false, fmt.Errorf("%s was not installed by agent-smith", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return false, false, err
+	}
+	orig := ChainedGitHook(path)
+	if _, err := os.Lstat(orig); err == nil {
+		if err := os.Rename(orig, path); err != nil {
+			return true, false, err
+		}
+		return true, true, nil
+	}
+	return true, false, nil
+}
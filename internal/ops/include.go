@@ -0,0 +1,117 @@
+package ops
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// includeDirective matches a line of the form `<!-- @include common/security.md -->`
+var includeDirective = regexp.MustCompile(`^\s*<!--\s*@include\s+(\S+)\s*-->\s*$`)
+
+// ResolveIncludes expands include directives found in content.
+// source is the file the content was read from and is only used for cycle
+// detection and error messages. Included paths are resolved against agentsDirs.
+func ResolveIncludes(content []byte, source string, agentsDirs []string) ([]byte, error) {
+	resolved, _, err := resolveIncludesFrom(content, source, agentsDirs)
+	return resolved, err
+}
+
+// resolveIncludesFrom is ResolveIncludes that also returns the files that were included
+func resolveIncludesFrom(content []byte, source string, agentsDirs []string) ([]byte, []string, error) {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		absSource = source
+	}
+	var included []string
+	resolved, err := resolveIncludes(content, absSource, agentsDirs, []string{absSource}, &included)
+	return resolved, included, err
+}
+
+func resolveIncludes(content []byte, source string, agentsDirs []string, stack []string, sources *[]string) ([]byte, error) {
+	var out bytes.Buffer
+	inFence := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !first {
+			out.WriteByte('\n')
+		}
+		first = false
+
+		// Directives inside fenced code blocks are documentation, not directives.
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		m := includeDirective.FindStringSubmatch(line)
+		if inFence || m == nil {
+			out.WriteString(line)
+			continue
+		}
+
+		includePath, err := resolveIncludePath(m[1], agentsDirs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+
+		for _, p := range stack {
+			if p == includePath {
+				chain := append(append([]string{}, stack...), includePath)
+				return nil, fmt.Errorf("include cycle detected: %s", strings.Join(chain, " -> "))
+			}
+		}
+
+		included, err := os.ReadFile(includePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: error reading include %s: %w", source, includePath, err)
+		}
+		*sources = append(*sources, includePath)
+
+		expanded, err := resolveIncludes(included, includePath, agentsDirs, append(stack, includePath), sources)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(bytes.TrimRight(expanded, "\r\n"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", source, err)
+	}
+
+	// Preserve the trailing newline of the original document
+	if bytes.HasSuffix(content, []byte("\n")) {
+		out.WriteByte('\n')
+	}
+
+	return out.Bytes(), nil
+}
+
+// resolveIncludePath locates an include reference. References are relative paths searched in
+// agentsDirs in order; absolute, ~ and .. references are refused so a persona cannot pull in
+// files from outside the persona directories.
+func resolveIncludePath(ref string, agentsDirs []string) (string, error) {
+	if ref == "~" || strings.HasPrefix(ref, "~/") || !filepath.IsLocal(ref) {
+		return "", fmt.Errorf("include %q must be a relative path inside the persona directories", ref)
+	}
+
+	for _, dir := range agentsDirs {
+		candidate := filepath.Join(ExpandPath(dir), ref)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			abs, err := filepath.Abs(candidate)
+			if err != nil {
+				return candidate, nil
+			}
+			return abs, nil
+		}
+	}
+
+	return "", fmt.Errorf("include %q not found (searched: %s)", ref, strings.Join(agentsDirs, ", "))
+}
@@ -0,0 +1,31 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// markerPrefix starts the comment that marks copies written by agent-smith
+const markerPrefix = "<!-- Managed by agent-smith"
+
+// AddMarker prepends the ownership marker comment to the content of a copy target
+func AddMarker(persona string, content []byte) []byte {
+	marker := fmt.Sprintf("%s (persona: %s). Run 'agents capture' to keep local edits. -->\n", markerPrefix, persona)
+	return append([]byte(marker), content...)
+}
+
+// HasMarker reports whether content starts with the ownership marker
+func HasMarker(content []byte) bool {
+	return bytes.HasPrefix(content, []byte(markerPrefix))
+}
+
+// StripMarker removes the ownership marker line, if any
+func StripMarker(content []byte) []byte {
+	if !HasMarker(content) {
+		return content
+	}
+	if i := bytes.IndexByte(content, '\n'); i >= 0 {
+		return content[i+1:]
+	}
+	return nil
+}
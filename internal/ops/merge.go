@@ -0,0 +1,118 @@
+package ops
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// headingPattern matches ATX markdown headings (# Title, ## Title, ...)
+var headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// section is a markdown heading together with its body and nested sections.
+// The document root has level 0 and no heading.
+type section struct {
+	heading  string
+	key      string
+	level    int
+	body     []string
+	children []*section
+}
+
+// MergeSections overlays child on parent by markdown heading.
+// A child section with the same heading as a parent section replaces its body
+// (when the child body is not blank) and merges its subsections recursively.
+// Child sections without a counterpart are appended after the parent's.
+func MergeSections(parent, child []byte) []byte {
+	dst := parseSections(parent)
+	mergeSection(dst, parseSections(child))
+
+	var buf bytes.Buffer
+	dst.render(&buf)
+	return buf.Bytes()
+}
+
+func parseSections(doc []byte) *section {
+	root := &section{}
+	stack := []*section{root}
+	inFence := false
+
+	text := strings.TrimSuffix(string(doc), "\n")
+	if text == "" {
+		return root
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		m := headingPattern.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if inFence || m == nil {
+			top := stack[len(stack)-1]
+			top.body = append(top.body, line)
+			continue
+		}
+
+		level := len(m[1])
+		for len(stack) > 1 && stack[len(stack)-1].level >= level {
+			stack = stack[:len(stack)-1]
+		}
+
+		s := &section{
+			heading: line,
+			key:     m[1] + " " + strings.ToLower(m[2]),
+			level:   level,
+		}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, s)
+		stack = append(stack, s)
+	}
+
+	return root
+}
+
+func mergeSection(dst, src *section) {
+	if !isBlank(src.body) {
+		dst.body = src.body
+	}
+
+	for _, c := range src.children {
+		var match *section
+		for _, d := range dst.children {
+			if d.key == c.key {
+				match = d
+				break
+			}
+		}
+		if match != nil {
+			mergeSection(match, c)
+		} else {
+			dst.children = append(dst.children, c)
+		}
+	}
+}
+
+func (s *section) render(buf *bytes.Buffer) {
+	if s.level > 0 {
+		buf.WriteString(s.heading)
+		buf.WriteByte('\n')
+	}
+	for _, line := range s.body {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	for _, c := range s.children {
+		c.render(buf)
+	}
+}
+
+func isBlank(lines []string) bool {
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			return false
+		}
+	}
+	return true
+}
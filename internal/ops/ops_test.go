@@ -2,9 +2,15 @@ package ops
 
 import (
 	"agent-smith/internal/config"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestExpandPath(t *testing.T) {
@@ -123,3 +129,829 @@ func floatPathAbs(t *testing.T, p string) string {
 	}
 	return abs
 }
+
+func TestResolveIncludes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_include_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sharedDir := filepath.Join(tempDir, "shared")
+	agentsDir := filepath.Join(tempDir, "agents")
+	if err := os.MkdirAll(filepath.Join(sharedDir, "common"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nested include resolved through the second search directory
+	os.WriteFile(filepath.Join(sharedDir, "common", "security.md"), []byte("## Security\n<!-- @include common/secrets.md -->\n"), 0644)
+	os.WriteFile(filepath.Join(sharedDir, "common", "secrets.md"), []byte("Never commit secrets.\n"), 0644)
+
+	agentFile := filepath.Join(agentsDir, "AGENTS.coder.md")
+	content := []byte("# Coder\n<!-- @include common/security.md -->\n```\n<!-- @include not/a/directive.md -->\n```\n")
+	os.WriteFile(agentFile, content, 0644)
+
+	got, err := ResolveIncludes(content, agentFile, []string{agentsDir, sharedDir})
+	if err != nil {
+		t.Fatalf("ResolveIncludes failed: %v", err)
+	}
+	want := "# Coder\n## Security\nNever commit secrets.\n```\n<!-- @include not/a/directive.md -->\n```\n"
+	if string(got) != want {
+		t.Errorf("ResolveIncludes() = %q, want %q", got, want)
+	}
+
+	// Missing include
+	if _, err := ResolveIncludes([]byte("<!-- @include missing.md -->"), agentFile, []string{agentsDir}); err == nil {
+		t.Error("Expected error for missing include")
+	}
+
+	// Includes cannot reach outside the persona directories
+	os.WriteFile(filepath.Join(tempDir, "secret.md"), []byte("Secret."), 0644)
+	for _, ref := range []string{filepath.Join(tempDir, "secret.md"), "../secret.md", "common/../../secret.md", "~/secret.md"} {
+		_, err := ResolveIncludes([]byte("<!-- @include "+ref+" -->"), agentFile, []string{agentsDir})
+		if err == nil || !strings.Contains(err.Error(), "inside the persona directories") {
+			t.Errorf("Expected include %q to be refused, got %v", ref, err)
+		}
+	}
+
+	// Cycle
+	os.WriteFile(filepath.Join(sharedDir, "common", "a.md"), []byte("<!-- @include common/b.md -->"), 0644)
+	os.WriteFile(filepath.Join(sharedDir, "common", "b.md"), []byte("<!-- @include common/a.md -->"), 0644)
+	_, err = ResolveIncludes([]byte("<!-- @include common/a.md -->"), agentFile, []string{sharedDir})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Expected include cycle error, got %v", err)
+	}
+}
+
+func TestApplyPersonaRenderedLink(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_render_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Unsetenv("XDG_STATE_HOME")
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	os.MkdirAll(agentsDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "rules.md"), []byte("Be careful."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("# Coder\n<!-- @include rules.md -->\n"), 0644)
+
+	linkTarget := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	targets := []config.TargetConfig{
+		{Path: linkTarget, Mode: config.TargetModeLink, Render: true},
+		{Path: copyTarget, Mode: config.TargetModeCopy},
+	}
+
+	if _, err := ApplyPersona("coder", []string{agentsDir}, targets); err != nil {
+		t.Fatalf("ApplyPersona failed: %v", err)
+	}
+
+	want := "# Coder\nBe careful.\n"
+
+	dest, err := os.Readlink(linkTarget)
+	if err != nil {
+		t.Fatalf("Expected symlink at %s: %v", linkTarget, err)
+	}
+	if filepath.Base(dest) != "AGENTS.coder.md" || !strings.HasPrefix(dest, filepath.Join(tempDir, "state", "agent-smith", "rendered")) {
+		t.Errorf("Expected link to a rendered copy in the state directory, got %s", dest)
+	}
+	if got, _ := os.ReadFile(linkTarget); string(got) != want {
+		t.Errorf("Rendered link content = %q, want %q", got, want)
+	}
+	if got, _ := os.ReadFile(copyTarget); string(got) != want {
+		t.Errorf("Copy content = %q, want %q", got, want)
+	}
+}
+
+func TestApplyPersonaUnchanged(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	linkTarget := filepath.Join(tempDir, "LINK.md")
+	renderedTarget := filepath.Join(tempDir, "RENDERED.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	targets := []config.TargetConfig{
+		{Path: linkTarget, Mode: config.TargetModeLink},
+		{Path: renderedTarget, Mode: config.TargetModeLink, Render: true},
+		{Path: copyTarget, Mode: config.TargetModeCopy},
+	}
+	apply := func() (*ApplyResult, string) {
+		t.Helper()
+		var out bytes.Buffer
+		result, err := ApplyPersonaWithOptions("coder", []string{agentsDir}, targets, ApplyOptions{Out: &out})
+		if err != nil {
+			t.Fatalf("ApplyPersona failed: %v", err)
+		}
+		return result, out.String()
+	}
+	unchanged := func(result *ApplyResult) []bool {
+		var got []bool
+		for _, tr := range result.Targets {
+			got = append(got, tr.Unchanged)
+		}
+		return got
+	}
+
+	if result, _ := apply(); !reflect.DeepEqual(unchanged(result), []bool{false, false, false}) {
+		t.Errorf("First apply: unchanged = %v, want none", unchanged(result))
+	}
+	before, err := os.Stat(copyTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Applying again writes nothing and says so
+	result, out := apply()
+	if !reflect.DeepEqual(unchanged(result), []bool{true, true, true}) {
+		t.Errorf("Second apply: unchanged = %v, want all", unchanged(result))
+	}
+	if strings.Contains(out, "Updated") || strings.Count(out, "Unchanged: ") != 3 {
+		t.Errorf("Expected every target to be reported unchanged, got:\n%s", out)
+	}
+	if after, err := os.Stat(copyTarget); err != nil || !os.SameFile(before, after) {
+		t.Errorf("The unchanged copy was rewritten")
+	}
+
+	// An edited persona changes the rendered targets but not the link to the persona file
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code better."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := apply(); !reflect.DeepEqual(unchanged(result), []bool{true, false, false}) {
+		t.Errorf("After an edit: unchanged = %v, want only the plain link", unchanged(result))
+	}
+
+	// A file in place of a link is replaced
+	if err := os.Remove(linkTarget); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(linkTarget, []byte("Code better."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := apply(); !reflect.DeepEqual(unchanged(result), []bool{false, true, true}) {
+		t.Errorf("After replacing the link: unchanged = %v, want the link rewritten", unchanged(result))
+	}
+	if info, err := os.Lstat(linkTarget); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to be a link again", linkTarget)
+	}
+}
+
+func TestSplitFrontmatter(t *testing.T) {
+	fm, body, err := SplitFrontmatter([]byte("---\nextends: base\n---\n# Body\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fm.Extends) != 1 || fm.Extends[0] != "base" {
+		t.Errorf("Expected extends [base], got %v", fm.Extends)
+	}
+	if string(body) != "# Body\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	fm, _, err = SplitFrontmatter([]byte("---\nextends: [a, b]\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fm.Extends) != 2 {
+		t.Errorf("Expected 2 parents, got %v", fm.Extends)
+	}
+
+	// No frontmatter
+	plain := []byte("# Title\n---\ntext\n")
+	_, body, err = SplitFrontmatter(plain)
+	if err != nil || string(body) != string(plain) {
+		t.Errorf("Expected content unchanged, got %q (%v)", body, err)
+	}
+}
+
+func TestMergeSections(t *testing.T) {
+	parent := "Preamble\n# Rules\nBase rules.\n## Security\nBase security.\n## Style\nBase style.\n# Tools\nAll tools.\n"
+	child := "# Rules\n## Security\nStrict security.\n## Testing\nWrite tests.\n# Review\nReview carefully.\n"
+
+	got := string(MergeSections([]byte(parent), []byte(child)))
+	want := "Preamble\n# Rules\nBase rules.\n## Security\nStrict security.\n## Style\nBase style.\n## Testing\nWrite tests.\n# Tools\nAll tools.\n# Review\nReview carefully.\n"
+	if got != want {
+		t.Errorf("MergeSections() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLoadPersonaExtends(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_extends_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.base.md"), []byte("# Role\nGeneric.\n# Rules\nBe kind.\n"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.coder.md"), []byte("---\nextends: base\n---\n# Role\nCoder.\n"), 0644)
+
+	p, err := LoadPersona("coder", []string{tempDir})
+	if err != nil {
+		t.Fatalf("LoadPersona failed: %v", err)
+	}
+	if want := "# Role\nCoder.\n# Rules\nBe kind.\n"; string(p.Content) != want {
+		t.Errorf("Content = %q, want %q", p.Content, want)
+	}
+	if strings.Join(p.Chain, ",") != "coder,base" {
+		t.Errorf("Chain = %v", p.Chain)
+	}
+
+	// Editing a parent or an include moves the source modification time
+	os.WriteFile(filepath.Join(tempDir, "rules.md"), []byte("Be brief.\n"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.base.md"), []byte("# Role\nGeneric.\n<!-- @include rules.md -->\n"), 0644)
+	p, err = LoadPersona("coder", []string{tempDir})
+	if err != nil {
+		t.Fatalf("LoadPersona failed: %v", err)
+	}
+	if len(p.Sources) != 3 || filepath.Base(p.Sources[2]) != "rules.md" {
+		t.Errorf("Sources = %v, want the persona, its parent and the include", p.Sources)
+	}
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	os.Chtimes(filepath.Join(tempDir, "rules.md"), later, later)
+	if got := p.SourceModTime(); !got.Equal(later) {
+		t.Errorf("SourceModTime = %v, want %v", got, later)
+	}
+
+	// Cycle
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.a.md"), []byte("---\nextends: b\n---\n"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.b.md"), []byte("---\nextends: a\n---\n"), 0644)
+	if _, err := LoadPersona("a", []string{tempDir}); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected extends cycle error, got %v", err)
+	}
+}
+
+func TestApplyPersonaTemplate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_template_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.Setenv("AGENTS_TEST_USER", "neo")
+	defer os.Unsetenv("AGENTS_TEST_USER")
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	os.MkdirAll(agentsDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"),
+		[]byte("---\ntemplate: true\n---\nTeam {{ .Vars.team }}, user {{ .Env.AGENTS_TEST_USER }}, target {{ .Target.Path }}{{ .Vars.missing }}\n"), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.raw.md"),
+		[]byte("Literal {{ .Vars.team }} and {{ unbalanced\n"), 0644)
+
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	targets := []config.TargetConfig{{Path: copyTarget, Mode: config.TargetModeCopy}}
+	opts := ApplyOptions{Vars: map[string]string{"team": "platform"}}
+
+	if _, err := ApplyPersonaWithOptions("coder", []string{agentsDir}, targets, opts); err != nil {
+		t.Fatalf("ApplyPersonaWithOptions failed: %v", err)
+	}
+	want := "Team platform, user neo, target " + copyTarget + "\n"
+	if got, _ := os.ReadFile(copyTarget); string(got) != want {
+		t.Errorf("Rendered content = %q, want %q", got, want)
+	}
+
+	if _, err := ApplyPersonaWithOptions("raw", []string{agentsDir}, targets, opts); err != nil {
+		t.Fatalf("ApplyPersonaWithOptions failed: %v", err)
+	}
+	if got, _ := os.ReadFile(copyTarget); string(got) != "Literal {{ .Vars.team }} and {{ unbalanced\n" {
+		t.Errorf("Expected a persona without template: true to be written as is, got %q", got)
+	}
+}
+
+func TestParseVars(t *testing.T) {
+	vars, err := ParseVars([]string{"team=platform", "url=a=b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["team"] != "platform" || vars["url"] != "a=b" {
+		t.Errorf("Unexpected vars: %v", vars)
+	}
+	if _, err := ParseVars([]string{"novalue"}); err == nil {
+		t.Error("Expected error for missing '='")
+	}
+}
+
+func TestListPersonasMetadata(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_list_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	first := filepath.Join(tempDir, "first")
+	second := filepath.Join(tempDir, "second")
+	os.MkdirAll(first, 0755)
+	os.MkdirAll(second, 0755)
+
+	os.WriteFile(filepath.Join(first, "AGENTS.coder.md"),
+		[]byte("---\ndescription: Senior Go engineer\ntags: [go, Backend]\nauthor: neo\nversion: \"1.2\"\ntargets: ~/.claude/CLAUDE.md\n---\n# Coder\n"), 0644)
+	os.WriteFile(filepath.Join(second, "AGENTS.coder.md"), []byte("Shadowed"), 0644)
+	os.WriteFile(filepath.Join(second, "AGENTS.writer.md"), []byte("Write."), 0644)
+	os.WriteFile(filepath.Join(second, "AGENTS.md"), []byte("Not a persona"), 0644)
+
+	entries := ListPersonas([]string{first, second, "/non/existent"})
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 personas, got %v", entries)
+	}
+	if entries[0].Name != "coder" || entries[0].Dir != first {
+		t.Errorf("Expected coder from %s, got %+v", first, entries[0])
+	}
+
+	p, err := LoadPersona("coder", []string{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Meta.Description != "Senior Go engineer" || p.Meta.Author != "neo" || p.Meta.Version != "1.2" {
+		t.Errorf("Unexpected metadata: %+v", p.Meta)
+	}
+	if !p.Meta.HasTag("backend") || p.Meta.HasTag("python") {
+		t.Errorf("Unexpected tags: %v", p.Meta.Tags)
+	}
+	if len(p.Meta.Targets) != 1 || p.Meta.Targets[0] != "~/.claude/CLAUDE.md" {
+		t.Errorf("Unexpected targets: %v", p.Meta.Targets)
+	}
+	if string(p.Content) != "# Coder\n" {
+		t.Errorf("Expected frontmatter stripped, got %q", p.Content)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	if got := UnifiedDiff("a", "b", []byte("same\n"), []byte("same\n")); got != "" {
+		t.Errorf("Expected no diff for equal content, got %q", got)
+	}
+
+	a := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")
+	b := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+	want := "--- a\n+++ b\n" +
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -8,3 +8,4 @@\n 8\n 9\n 10\n+11\n"
+	if got := UnifiedDiff("a", "b", a, b); got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	// A missing final newline is a change of its own
+	want = "--- a\n+++ b\n@@ -1,2 +1,2 @@\n 1\n-2\n+2\n\\ No newline at end of file\n"
+	if got := UnifiedDiff("a", "b", []byte("1\n2\n"), []byte("1\n2")); got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	// Files too far apart are shown as a whole-file replace
+	var many, other strings.Builder
+	for i := 0; i < maxDiffEdits; i++ {
+		fmt.Fprintf(&many, "a%d\n", i)
+		fmt.Fprintf(&other, "b%d\n", i)
+	}
+	got := UnifiedDiff("a", "b", []byte(many.String()), []byte(other.String()))
+	if !strings.Contains(got, fmt.Sprintf("@@ -1,%d +1,%d @@\n-a0\n", maxDiffEdits, maxDiffEdits)) {
+		t.Errorf("Expected a whole-file replace, got:\n%.200s", got)
+	}
+}
+
+func TestCapturePersona(t *testing.T) {
+	tmpDir := t.TempDir()
+	agentPath := filepath.Join(tmpDir, "AGENTS.coder.md")
+	os.WriteFile(agentPath, []byte("---\ndescription: Coder\n---\nOld body.\n"), 0600)
+
+	if err := CapturePersona(agentPath, []byte("New body.\n")); err != nil {
+		t.Fatalf("CapturePersona failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(agentPath)
+	if string(content) != "---\ndescription: Coder\n---\nNew body.\n" {
+		t.Errorf("Expected frontmatter kept and body replaced, got %q", content)
+	}
+	if info, _ := os.Stat(agentPath); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600 kept, got %v", info.Mode().Perm())
+	}
+
+	// Symlinked persona files are written through
+	linkPath := filepath.Join(tmpDir, "AGENTS.link.md")
+	os.Symlink(agentPath, linkPath)
+	if err := CapturePersona(linkPath, []byte("Linked.\n")); err != nil {
+		t.Fatalf("CapturePersona via symlink failed: %v", err)
+	}
+	if info, _ := os.Lstat(linkPath); info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Expected persona symlink to be preserved")
+	}
+	if body, _ := PersonaBody(agentPath); string(body) != "Linked.\n" {
+		t.Errorf("Expected body written through symlink, got %q", body)
+	}
+}
+
+func TestMarker(t *testing.T) {
+	marked := AddMarker("coder", []byte("Body.\n"))
+	if !HasMarker(marked) {
+		t.Fatalf("Expected marker, got %q", marked)
+	}
+	if string(StripMarker(marked)) != "Body.\n" {
+		t.Errorf("Expected marker stripped, got %q", StripMarker(marked))
+	}
+	if string(StripMarker([]byte("Body.\n"))) != "Body.\n" {
+		t.Error("StripMarker changed unmarked content")
+	}
+}
+
+func TestApplyPersonaRollback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	os.MkdirAll(agentsDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644)
+
+	linkTarget := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	os.Symlink(filepath.Join(agentsDir, "AGENTS.writer.md"), linkTarget)
+	os.WriteFile(copyTarget, []byte("Write."), 0640)
+
+	// A file where a directory is needed makes the last target fail
+	blocker := filepath.Join(tempDir, "blocker")
+	os.WriteFile(blocker, []byte("x"), 0644)
+
+	targets := []config.TargetConfig{
+		{Path: linkTarget, Mode: config.TargetModeLink},
+		{Path: copyTarget, Mode: config.TargetModeCopy},
+		{Path: filepath.Join(tempDir, "NEW.md"), Mode: config.TargetModeCopy},
+		{Path: filepath.Join(blocker, "AGENTS.md"), Mode: config.TargetModeLink},
+	}
+
+	result, err := ApplyPersonaWithOptions("coder", []string{agentsDir}, targets, ApplyOptions{Out: io.Discard})
+	if err == nil {
+		t.Fatal("Expected apply to fail")
+	}
+	if dest, _ := os.Readlink(linkTarget); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected link rolled back to writer, got %s", dest)
+	}
+	if content, _ := os.ReadFile(copyTarget); string(content) != "Write." {
+		t.Errorf("Expected copy rolled back, got %q", content)
+	}
+	if info, _ := os.Stat(copyTarget); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected copy permissions restored, got %v", info.Mode().Perm())
+	}
+	if _, err := os.Lstat(filepath.Join(tempDir, "NEW.md")); !os.IsNotExist(err) {
+		t.Error("Expected new target removed by rollback")
+	}
+	for _, tr := range result.Targets[:3] {
+		if !tr.RolledBack {
+			t.Errorf("Expected %s marked as rolled back", tr.Path)
+		}
+	}
+
+	// Best effort keeps the targets that succeeded
+	if _, err := ApplyPersonaWithOptions("coder", []string{agentsDir}, targets, ApplyOptions{Out: io.Discard, BestEffort: true}); err == nil {
+		t.Fatal("Expected best-effort apply to report the failure")
+	}
+	if dest, _ := os.Readlink(linkTarget); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected best-effort apply to keep the link on coder, got %s", dest)
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/release/1.2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(repo, "cmd", "tool")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := GitBranch(sub); got != "release/1.2" {
+		t.Fatalf("GitBranch = %q, want release/1.2", got)
+	}
+
+	env := map[string]string{"CI": "true"}
+	ctx := RuleContext{
+		Dir:    sub,
+		Branch: GitBranch(sub),
+		Host:   "laptop.local",
+		Env: func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		},
+		Now: time.Date(2025, 12, 14, 23, 30, 0, 0, time.Local),
+	}
+
+	tests := []struct {
+		name string
+		rule config.Rule
+		want bool
+	}{
+		{"no conditions", config.Rule{Persona: "p"}, true},
+		{"dir exact", config.Rule{Dir: sub}, true},
+		{"dir recursive", config.Rule{Dir: repo + "/**"}, true},
+		{"dir not recursive", config.Rule{Dir: repo}, false},
+		{"branch glob", config.Rule{Branch: "release/*"}, true},
+		{"branch mismatch", config.Rule{Branch: "main"}, false},
+		{"host glob", config.Rule{Host: "*.local"}, true},
+		{"env set", config.Rule{Env: "CI"}, true},
+		{"env unset", config.Rule{Env: "HOME_OFFICE"}, false},
+		{"env value", config.Rule{Env: "CI=t*"}, true},
+		{"env value mismatch", config.Rule{Env: "CI=false"}, false},
+		{"time window", config.Rule{Time: "22:00-23:45"}, true},
+		{"time wraps midnight", config.Rule{Time: "22:00-06:00"}, true},
+		{"time outside", config.Rule{Time: "08:00-18:00"}, false},
+		{"time end excluded", config.Rule{Time: "20:00-23:30"}, false},
+		{"all conditions", config.Rule{Dir: repo + "/**", Branch: "release/*", Time: "08:00-18:00"}, false},
+	}
+	for _, tt := range tests {
+		if got := MatchRule(tt.rule, ctx); got.Matched != tt.want {
+			t.Errorf("%s: matched = %v, want %v (%+v)", tt.name, got.Matched, tt.want, got.Conditions)
+		}
+	}
+
+	if m := MatchRule(config.Rule{Time: "late"}, ctx); m.Matched || m.Conditions[0].Err == nil {
+		t.Errorf("expected invalid time window to fail with an error, got %+v", m.Conditions)
+	}
+
+	matches := EvaluateRules([]config.Rule{
+		{Name: "work", Persona: "coder", Time: "08:00-18:00"},
+		{Name: "ci", Persona: "ci", Env: "CI"},
+		{Name: "fallback", Persona: "writer"},
+	}, ctx)
+	first := FirstMatch(matches)
+	if first == nil || first.Rule.Name != "ci" || first.Index != 1 {
+		t.Fatalf("FirstMatch = %+v, want rule ci", first)
+	}
+}
+
+func TestGitRepo(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(root, ".git")
+	os.MkdirAll(filepath.Join(gitDir, "worktrees", "wt"), 0755)
+	os.WriteFile(filepath.Join(gitDir, "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+
+	repo, err := FindGitRepo(root)
+	if err != nil || repo == nil {
+		t.Fatalf("FindGitRepo failed: %v", err)
+	}
+	if got := repo.HooksDir(); got != filepath.Join(gitDir, "hooks") {
+		t.Errorf("HooksDir = %q, want .git/hooks", got)
+	}
+
+	os.WriteFile(filepath.Join(gitDir, "config"), []byte("[core]\n\tbare = false\n\thooksPath = .githooks\n"), 0644)
+	if got := repo.HooksDir(); got != filepath.Join(root, ".githooks") {
+		t.Errorf("HooksDir = %q, want core.hooksPath relative to the work tree", got)
+	}
+
+	// Empty section headers are skipped instead of crashing the parser
+	os.WriteFile(filepath.Join(gitDir, "config"), []byte("[]\n\thooksPath = nope\n[ ]\n[core]\n\thooksPath = .githooks\n"), 0644)
+	if got := repo.HooksDir(); got != filepath.Join(root, ".githooks") {
+		t.Errorf("HooksDir = %q with empty section headers, want core.hooksPath", got)
+	}
+
+	// A linked worktree shares hooks with the main repository
+	wt := filepath.Join(t.TempDir(), "wt")
+	os.MkdirAll(wt, 0755)
+	wtGitDir := filepath.Join(gitDir, "worktrees", "wt")
+	os.WriteFile(filepath.Join(wt, ".git"), []byte("gitdir: "+wtGitDir+"\n"), 0644)
+	os.WriteFile(filepath.Join(wtGitDir, "commondir"), []byte("../..\n"), 0644)
+	os.WriteFile(filepath.Join(wtGitDir, "HEAD"), []byte("ref: refs/heads/docs/intro\n"), 0644)
+
+	wtRepo, err := FindGitRepo(wt)
+	if err != nil || wtRepo == nil {
+		t.Fatalf("FindGitRepo(worktree) failed: %v", err)
+	}
+	if wtRepo.CommonDir != gitDir {
+		t.Errorf("CommonDir = %q, want %q", wtRepo.CommonDir, gitDir)
+	}
+	if wtRepo.Branch() != "docs/intro" {
+		t.Errorf("Branch = %q, want docs/intro", wtRepo.Branch())
+	}
+
+	rules := []config.BranchRule{{Pattern: "docs/*", Persona: "writer"}, {Pattern: "*", Persona: "coder"}}
+	if r, ok := BranchPersona(rules, "docs/intro"); !ok || r.Persona != "writer" {
+		t.Errorf("BranchPersona(docs/intro) = %+v, %v", r, ok)
+	}
+	if r, ok := BranchPersona(rules, "main"); !ok || r.Persona != "coder" {
+		t.Errorf("BranchPersona(main) = %+v, %v", r, ok)
+	}
+	if _, ok := BranchPersona(rules, ""); ok {
+		t.Errorf("BranchPersona must not match a detached HEAD")
+	}
+}
+
+func TestInstallGitHook(t *testing.T) {
+	hooks := t.TempDir()
+	path := filepath.Join(hooks, "post-checkout")
+	os.WriteFile(path, []byte("#!/bin/sh\necho mine\n"), 0755)
+
+	script := "#!/bin/sh\n" + GitHookMarker + "\n"
+	if chained, err := InstallGitHook(path, script); err != nil || !chained {
+		t.Fatalf("InstallGitHook = %v, %v; want chained", chained, err)
+	}
+	if chained, err := InstallGitHook(path, script); err != nil || chained {
+		t.Fatalf("reinstall = %v, %v; want replaced without chaining", chained, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("hook must be executable: %v", err)
+	}
+
+	removed, restored, err := UninstallGitHook(path)
+	if err != nil || !removed || !restored {
+		t.Fatalf("UninstallGitHook = %v, %v, %v", removed, restored, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "#!/bin/sh\necho mine\n" {
+		t.Errorf("original hook not restored: %q", data)
+	}
+	if _, _, err := UninstallGitHook(path); err == nil {
+		t.Errorf("expected a hook not installed by agent-smith to be refused")
+	}
+}
+
+func TestChangedPaths(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "AGENTS.coder.md")
+	link := filepath.Join(dir, "AGENTS.md")
+	os.WriteFile(file, []byte("Code."), 0644)
+	os.Symlink(file, link)
+
+	if files := PersonaSourceFiles([]string{dir, filepath.Join(dir, "missing")}); len(files) != 2 {
+		t.Errorf("PersonaSourceFiles = %v, want 2 files", files)
+	}
+
+	paths := []string{file, link}
+	before := StampPaths(paths)
+	if changed := ChangedPaths(before, StampPaths(paths)); len(changed) != 0 {
+		t.Errorf("expected no change, got %v", changed)
+	}
+
+	os.Remove(link)
+	os.Symlink(filepath.Join(dir, "AGENTS.writer.md"), link)
+	os.WriteFile(file, []byte("Code more."), 0644)
+	changed := ChangedPaths(before, StampPaths(paths))
+	if len(changed) != 2 || changed[0] != file || changed[1] != link {
+		t.Errorf("ChangedPaths = %v, want both paths", changed)
+	}
+
+	if changed := ChangedPaths(before, StampPaths(paths[:1])); len(changed) != 2 {
+		t.Errorf("a path that is no longer watched counts as changed, got %v", changed)
+	}
+}
+
+func TestServiceFiles(t *testing.T) {
+	spec := ServiceSpec{
+		Mode:       ServiceWatch,
+		Executable: "/opt/agent smith/agents",
+		ConfigFile: "/etc/agents%1$HOME.yaml",
+		Env:        map[string]string{"XDG_STATE_HOME": "/s$x"},
+	}
+	files, err := SystemdUnits(spec, "/u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "/u/agent-smith.service" {
+		t.Fatalf("watch mode should only write the service, got %v", files)
+	}
+	for _, want := range []string{
+		`ExecStart="/opt/agent smith/agents" --config /etc/agents%%1$$HOME.yaml watch`,
+		"Environment=XDG_STATE_HOME=/s$x\n",
+		"Restart=on-failure",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(files[0].Content, want) {
+			t.Errorf("service missing %q:\n%s", want, files[0].Content)
+		}
+	}
+
+	spec.Mode = ServiceTimer
+	spec.Interval = 90 * time.Minute
+	files, err = SystemdUnits(spec, "/u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || !strings.Contains(files[0].Content, "Type=oneshot") || !strings.Contains(files[0].Content, "reconcile") {
+		t.Fatalf("timer mode should write a oneshot reconcile service, got %v", files)
+	}
+	if !strings.Contains(files[1].Content, "OnUnitActiveSec=5400s") || SystemdEnableUnit(ServiceTimer) != "agent-smith.timer" {
+		t.Errorf("unexpected timer:\n%s", files[1].Content)
+	}
+
+	spec.Mode = ServicePath
+	if _, err := SystemdUnits(spec, "/u"); err == nil {
+		t.Error("path mode without paths should fail")
+	}
+	spec.WatchPaths = []string{"/p/personas", "/p/agents"}
+	plist, err := LaunchdPlist(spec, "/l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<key>WatchPaths</key>", "<string>/p/personas</string>", "<string>/opt/agent smith/agents</string>", "<string>reconcile</string>"} {
+		if !strings.Contains(plist.Content, want) {
+			t.Errorf("plist missing %q:\n%s", want, plist.Content)
+		}
+	}
+	if plist.Path != "/l/agent-smith.plist" {
+		t.Errorf("plist path = %s", plist.Path)
+	}
+
+	spec.Mode = "cron"
+	if _, err := SystemdUnits(spec, "/u"); err == nil {
+		t.Error("unknown mode should fail")
+	}
+}
+
+func TestApplyPersonaVariants(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_variants_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(tempDir, "AGENTS.gemini-coder.md"), []byte("---\ntemplate: true\n---\nCode as {{ .Persona }}."), 0644)
+
+	variants := map[string]string{"coder": "gemini-coder"}
+	targets := []config.TargetConfig{
+		{Path: filepath.Join(tempDir, "AGENTS.md"), Mode: config.TargetModeLink},
+		{Path: filepath.Join(tempDir, "GEMINI.md"), Mode: config.TargetModeCopy, Variants: variants},
+		{Path: filepath.Join(tempDir, "LINK.md"), Mode: config.TargetModeLink, Variants: variants},
+	}
+	result, err := ApplyPersonaWithOptions("coder", []string{tempDir}, targets, ApplyOptions{Out: io.Discard})
+	if err != nil {
+		t.Fatalf("ApplyPersonaWithOptions failed: %v", err)
+	}
+	if result.Targets[0].Variant != "" || result.Targets[1].Variant != "gemini-coder" {
+		t.Errorf("unexpected variants: %+v", result.Targets)
+	}
+	if content, _ := os.ReadFile(targets[1].Path); string(content) != "Code as gemini-coder." {
+		t.Errorf("copy = %q, want the rendered variant", content)
+	}
+	if dest, _ := os.Readlink(targets[2].Path); filepath.Base(dest) != "AGENTS.gemini-coder.md" {
+		t.Errorf("link = %s, want the variant", dest)
+	}
+	if got := targets[1].PersonaFor("writer"); got != "writer" {
+		t.Errorf("PersonaFor(writer) = %s, want writer", got)
+	}
+
+	// A missing variant rolls back the whole apply
+	os.Remove(filepath.Join(tempDir, "AGENTS.gemini-coder.md"))
+	os.Remove(targets[1].Path)
+	if _, err := ApplyPersonaWithOptions("coder", []string{tempDir}, targets, ApplyOptions{Out: io.Discard}); err == nil || !strings.Contains(err.Error(), "gemini-coder") {
+		t.Errorf("expected a missing variant error, got %v", err)
+	}
+	if _, err := os.Stat(targets[1].Path); !os.IsNotExist(err) {
+		t.Errorf("expected no copy after the failed apply")
+	}
+}
+
+func TestPlanApplyLinkDest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "ops_plan_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	persona := filepath.Join(tempDir, "AGENTS.coder.md")
+	if err := os.WriteFile(persona, []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tempDir, "FILE.md")
+	if err := os.WriteFile(file, []byte("Mine."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	linked := filepath.Join(tempDir, "LINKED.md")
+	if err := os.Symlink(persona, linked); err != nil {
+		t.Fatal(err)
+	}
+
+	targets := []config.TargetConfig{
+		{Path: filepath.Join(tempDir, "NEW.md"), Mode: config.TargetModeLink},
+		{Path: file, Mode: config.TargetModeLink},
+		{Path: linked, Mode: config.TargetModeLink},
+	}
+	actions, err := PlanApply("coder", []string{tempDir}, targets, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("PlanApply failed: %v", err)
+	}
+
+	want := map[string]string{targets[0].Path: PlanCreateLink, file: PlanReplaceLink, linked: PlanUnchanged}
+	for _, a := range actions {
+		action, ok := want[a.Path]
+		if !ok {
+			continue
+		}
+		delete(want, a.Path)
+		if a.Action != action || a.Dest != persona {
+			t.Errorf("%s: got %s -> %q, want %s -> %q", a.Path, a.Action, a.Dest, action, persona)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("no action planned for %v", want)
+	}
+}
@@ -0,0 +1,198 @@
+package ops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"agent-smith/internal/config"
+)
+
+// Persona is a persona file with its includes and inheritance resolved
+type Persona struct {
+	Name string
+	Path string
+	Meta Frontmatter
+	// Chain lists the persona followed by every persona it extends, in resolution order
+	Chain []string
+	// Content is the merged document without frontmatter
+	Content []byte
+	// Sources are the files the persona was read from: the persona files of the chain and their includes
+	Sources []string
+}
+
+// SourceModTime returns the latest modification time of the persona's sources,
+// or the zero time if none can be read
+func (p *Persona) SourceModTime() time.Time {
+	var latest time.Time
+	for _, path := range p.Sources {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// FindPersona returns the path of AGENTS.<persona>.md in the first agents directory that has it
+func FindPersona(persona string, agentsDirs []string) (string, error) {
+	agentFileName := fmt.Sprintf("AGENTS.%s.md", persona)
+	for _, dir := range agentsDirs {
+		candidate := filepath.Join(dir, agentFileName)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("persona not found")
+}
+
+// PersonaEntry is a persona file found in an agents directory
+type PersonaEntry struct {
+	Name string
+	Dir  string
+	Path string
+}
+
+// ListPersonas returns every persona in agentsDirs.
+// A persona found in several directories is listed once, from the first directory.
+func ListPersonas(agentsDirs []string) []PersonaEntry {
+	var entries []PersonaEntry
+	seen := make(map[string]bool)
+
+	for _, agentsDir := range agentsDirs {
+		// Missing directories are skipped; we do not create them (they may be read-only, e.g. on NixOS).
+		files, err := os.ReadDir(agentsDir)
+		if err != nil {
+			continue
+		}
+
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			name := file.Name()
+			if strings.HasPrefix(name, "AGENTS.") && strings.HasSuffix(name, ".md") && name != "AGENTS.md" {
+				// Extract persona name: AGENTS.coder.md -> coder
+				persona := strings.TrimSuffix(strings.TrimPrefix(name, "AGENTS."), ".md")
+				if !seen[persona] {
+					seen[persona] = true
+					entries = append(entries, PersonaEntry{
+						Name: persona,
+						Dir:  agentsDir,
+						Path: filepath.Join(agentsDir, name),
+					})
+				}
+			}
+		}
+	}
+
+	return entries
+}
+
+// LoadPersona locates a persona and resolves its includes and `extends:` chain
+func LoadPersona(name string, agentsDirs []string) (*Persona, error) {
+	return loadPersona(name, agentsDirs, nil)
+}
+
+func loadPersona(name string, agentsDirs []string, stack []string) (*Persona, error) {
+	for _, s := range stack {
+		if s == name {
+			chain := append(append([]string{}, stack...), name)
+			return nil, fmt.Errorf("extends cycle detected: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	agentPath, err := FindPersona(name, agentsDirs)
+	if err != nil {
+		if len(stack) > 0 {
+			return nil, fmt.Errorf("persona '%s' extends unknown persona '%s'", stack[len(stack)-1], name)
+		}
+		return nil, fmt.Errorf("persona '%s' not found", name)
+	}
+
+	raw, err := os.ReadFile(agentPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading persona file %s: %w", agentPath, err)
+	}
+
+	meta, body, err := SplitFrontmatter(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", agentPath, err)
+	}
+
+	body, included, err := resolveIncludesFrom(body, agentPath, agentsDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Persona{
+		Name:    name,
+		Path:    agentPath,
+		Meta:    meta,
+		Chain:   []string{name},
+		Content: body,
+		Sources: append([]string{agentPath}, included...),
+	}
+
+	if len(meta.Extends) == 0 {
+		return p, nil
+	}
+
+	// Merge parents in order, then overlay this persona
+	var merged []byte
+	for i, parentName := range meta.Extends {
+		parent, err := loadPersona(parentName, agentsDirs, append(stack, name))
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			merged = parent.Content
+		} else {
+			merged = MergeSections(merged, parent.Content)
+		}
+		for _, c := range parent.Chain {
+			if !slices.Contains(p.Chain, c) {
+				p.Chain = append(p.Chain, c)
+			}
+		}
+		for _, src := range parent.Sources {
+			if !slices.Contains(p.Sources, src) {
+				p.Sources = append(p.Sources, src)
+			}
+		}
+	}
+	p.Content = MergeSections(merged, body)
+
+	return p, nil
+}
+
+// RenderedDir returns the directory holding the rendered documents of a link target.
+// Each target gets its own directory since templates may render differently per target.
+// It lives under the state directory: a cleared cache would leave the links dangling.
+func RenderedDir(targetPath string) (string, error) {
+	stateHome, err := config.GetStateHome()
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(ExpandPath(targetPath))
+	if err != nil {
+		absTarget = targetPath
+	}
+	sum := sha256.Sum256([]byte(absTarget))
+	key := hex.EncodeToString(sum[:])[:16]
+	return filepath.Join(stateHome, "agent-smith", "rendered", key), nil
+}
+
+// RenderedPath returns where the rendered document of a persona is kept for a link target.
+// The file keeps the AGENTS.<persona>.md name so the active persona can still be inferred from the link.
+func RenderedPath(persona, targetPath string) (string, error) {
+	dir, err := RenderedDir(targetPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("AGENTS.%s.md", persona)), nil
+}
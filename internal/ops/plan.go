@@ -0,0 +1,130 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"agent-smith/internal/config"
+)
+
+// Plan actions describe a single filesystem change without making it
+const (
+	PlanMkdir         = "mkdir"
+	PlanCreateLink    = "create-link"
+	PlanReplaceLink   = "replace-link"
+	PlanCreateCopy    = "create-copy"
+	PlanOverwriteCopy = "overwrite-copy"
+	PlanWriteRender   = "write-rendered"
+	PlanUnchanged     = "unchanged"
+	PlanBackup        = "backup"
+	PlanCapture       = "capture"
+	PlanRemove        = "remove"
+	PlanSkipShared    = "skip-shared"
+	PlanSkipForeign   = "skip-foreign"
+	PlanSkip          = "skip"
+	PlanRestoreState  = "restore-state"
+)
+
+// PlanAction is a change a command would make in dry-run mode
+type PlanAction struct {
+	Action  string
+	Path    string
+	Details string
+	// Dest is where a link action points the link
+	Dest string
+}
+
+// PlanApply returns the actions ApplyPersonaWithOptions would take for targets, without touching the filesystem.
+// Rendering errors are returned as they would be by the apply.
+func PlanApply(persona string, agentsDirs []string, targets []config.TargetConfig, opts ApplyOptions) ([]PlanAction, error) {
+	agentPath, err := FindPersona(persona, agentsDirs)
+	if err != nil {
+		return nil, err
+	}
+	personas := newPersonaSet(persona, agentPath, agentsDirs)
+
+	var actions []PlanAction
+	dirs := make(map[string]bool)
+
+	mkdir := func(path string) {
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			return
+		}
+		dirs[dir] = true
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			actions = append(actions, PlanAction{Action: PlanMkdir, Path: dir})
+		}
+	}
+
+	for _, target := range targets {
+		targetPath := ExpandPath(target.Path)
+		targetPersona := target.PersonaFor(persona)
+		targetAgentPath, err := personas.path(targetPersona)
+		if err != nil {
+			return actions, fmt.Errorf("%s: variant of '%s': %w", targetPath, persona, err)
+		}
+
+		_, content, rendered, err := personas.render(targetPersona, target, opts.Vars)
+		if err != nil {
+			return actions, err
+		}
+
+		mkdir(targetPath)
+
+		if target.Mode == config.TargetModeCopy {
+			actions = append(actions, planCopy(targetPath, content))
+			continue
+		}
+
+		linkDest, err := filepath.Abs(targetAgentPath)
+		if err != nil {
+			linkDest = targetAgentPath
+		}
+		if rendered {
+			cachePath, err := RenderedPath(targetPersona, targetPath)
+			if err != nil {
+				return actions, fmt.Errorf("error locating rendered copy: %w", err)
+			}
+			mkdir(cachePath)
+			if current, err := os.ReadFile(cachePath); err != nil || !bytes.Equal(current, content) {
+				actions = append(actions, PlanAction{Action: PlanWriteRender, Path: cachePath})
+			}
+			linkDest = cachePath
+		}
+		actions = append(actions, planLink(targetPath, linkDest))
+	}
+
+	return actions, nil
+}
+
+func planCopy(path string, content []byte) PlanAction {
+	info, err := os.Lstat(path)
+	switch {
+	case err != nil:
+		return PlanAction{Action: PlanCreateCopy, Path: path}
+	case info.Mode()&os.ModeSymlink != 0:
+		return PlanAction{Action: PlanOverwriteCopy, Path: path, Details: "Replaces a symlink"}
+	}
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, content) {
+		return PlanAction{Action: PlanUnchanged, Path: path}
+	}
+	return PlanAction{Action: PlanOverwriteCopy, Path: path}
+}
+
+func planLink(path, dest string) PlanAction {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return PlanAction{Action: PlanCreateLink, Path: path, Details: "-> " + dest, Dest: dest}
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return PlanAction{Action: PlanReplaceLink, Path: path, Details: "Replaces a file with -> " + dest, Dest: dest}
+	}
+	current, err := os.Readlink(path)
+	if err == nil && filepath.Clean(current) == filepath.Clean(dest) {
+		return PlanAction{Action: PlanUnchanged, Path: path, Dest: dest}
+	}
+	return PlanAction{Action: PlanReplaceLink, Path: path, Details: fmt.Sprintf("%s -> %s", current, dest), Dest: dest}
+}
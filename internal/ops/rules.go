@@ -0,0 +1,155 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-smith/internal/config"
+)
+
+// RuleContext is what rule conditions are evaluated against
+type RuleContext struct {
+	Dir    string
+	Branch string
+	Host   string
+	Env    func(string) (string, bool)
+	Now    time.Time
+}
+
+// NewRuleContext describes the current environment for rules evaluated in dir
+func NewRuleContext(dir string) RuleContext {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	host, _ := os.Hostname()
+	return RuleContext{
+		Dir:    dir,
+		Branch: GitBranch(dir),
+		Host:   host,
+		Env:    os.LookupEnv,
+		Now:    time.Now(),
+	}
+}
+
+// RuleCondition is the outcome of a single condition of a rule
+type RuleCondition struct {
+	Condition string // dir, branch, host, env or time
+	Pattern   string
+	Value     string
+	Matched   bool
+	Err       error
+}
+
+// RuleMatch is the outcome of evaluating a rule
+type RuleMatch struct {
+	Index      int
+	Rule       config.Rule
+	Matched    bool
+	Conditions []RuleCondition
+}
+
+// EvaluateRules evaluates every rule in order
+func EvaluateRules(rules []config.Rule, ctx RuleContext) []RuleMatch {
+	var matches []RuleMatch
+	for i, rule := range rules {
+		m := MatchRule(rule, ctx)
+		m.Index = i
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// FirstMatch returns the first matched rule, or nil if none matched
+func FirstMatch(matches []RuleMatch) *RuleMatch {
+	for i := range matches {
+		if matches[i].Matched {
+			return &matches[i]
+		}
+	}
+	return nil
+}
+
+// MatchRule evaluates the conditions of rule; all of them must match
+func MatchRule(rule config.Rule, ctx RuleContext) RuleMatch {
+	m := RuleMatch{Rule: rule, Matched: true}
+	add := func(c RuleCondition) {
+		if !c.Matched {
+			m.Matched = false
+		}
+		m.Conditions = append(m.Conditions, c)
+	}
+
+	if rule.Dir != "" {
+		ok, err := matchDir(rule.Dir, ctx.Dir)
+		add(RuleCondition{Condition: "dir", Pattern: rule.Dir, Value: ctx.Dir, Matched: ok, Err: err})
+	}
+	if rule.Branch != "" {
+		ok, err := filepath.Match(rule.Branch, ctx.Branch)
+		add(RuleCondition{Condition: "branch", Pattern: rule.Branch, Value: ctx.Branch, Matched: ok && ctx.Branch != "", Err: err})
+	}
+	if rule.Host != "" {
+		ok, err := filepath.Match(rule.Host, ctx.Host)
+		add(RuleCondition{Condition: "host", Pattern: rule.Host, Value: ctx.Host, Matched: ok, Err: err})
+	}
+	if rule.Env != "" {
+		name, pattern, hasPattern := strings.Cut(rule.Env, "=")
+		value, set := ctx.Env(name)
+		c := RuleCondition{Condition: "env", Pattern: rule.Env, Value: value}
+		if hasPattern {
+			c.Matched, c.Err = filepath.Match(pattern, value)
+			c.Matched = c.Matched && set
+		} else {
+			c.Matched = value != ""
+		}
+		add(c)
+	}
+	if rule.Time != "" {
+		ok, err := matchTime(rule.Time, ctx.Now)
+		add(RuleCondition{Condition: "time", Pattern: rule.Time, Value: ctx.Now.Format("15:04"), Matched: ok, Err: err})
+	}
+	return m
+}
+
+// matchDir matches a directory glob; a trailing /** also matches any subdirectory
+func matchDir(pattern, dir string) (bool, error) {
+	pattern = ExpandPath(pattern)
+	base, recursive := strings.CutSuffix(pattern, "/**")
+	if !recursive {
+		return filepath.Match(pattern, dir)
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		ok, err := filepath.Match(base, d)
+		if err != nil || ok {
+			return ok, err
+		}
+		if filepath.Dir(d) == d {
+			return false, nil
+		}
+	}
+}
+
+// matchTime reports whether now is within a HH:MM-HH:MM window (wrapping past midnight if start > end)
+func matchTime(window string, now time.Time) (bool, error) {
+	startStr, endStr, ok := strings.Cut(window, "-")
+	if !ok {
+		return false, fmt.Errorf("invalid time window %q (expected HH:MM-HH:MM)", window)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(startStr))
+	if err != nil {
+		return false, fmt.Errorf("invalid time window %q: %w", window, err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(endStr))
+	if err != nil {
+		return false, fmt.Errorf("invalid time window %q: %w", window, err)
+	}
+
+	minutes := func(t time.Time) int { return t.Hour()*60 + t.Minute() }
+	n, s, e := minutes(now), minutes(start), minutes(end)
+	if s <= e {
+		return n >= s && n < e, nil
+	}
+	return n >= s || n < e, nil
+}
@@ -0,0 +1,230 @@
+package ops
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ServiceName is the name of the units and the launchd label installed by `agents service`
+const ServiceName = "agent-smith"
+
+// Service modes
+const (
+	ServiceWatch = "watch" // run `agents watch` continuously
+	ServiceTimer = "timer" // run `agents reconcile` periodically
+	ServicePath  = "path"  // run `agents reconcile` when a watched path changes
+)
+
+// ServiceSpec describes the background service to generate
+type ServiceSpec struct {
+	Mode       string
+	Executable string
+	// ConfigFile is passed with --config when set, so the service uses the same config
+	ConfigFile string
+	// Interval is the period of the timer mode, and the poll interval passed to watch when set
+	Interval time.Duration
+	// WatchPaths trigger a reconcile in path mode
+	WatchPaths []string
+	// Env is set in the service environment (XDG directories and AGENTS_* overrides)
+	Env map[string]string
+	// LogPath receives the output of the launchd agent
+	LogPath string
+}
+
+// ServiceFile is a generated unit or property list
+type ServiceFile struct {
+	Path    string
+	Content string
+}
+
+// command returns the agents command line the service runs
+func (s ServiceSpec) command() []string {
+	args := []string{s.Executable}
+	if s.ConfigFile != "" {
+		args = append(args, "--config", s.ConfigFile)
+	}
+	if s.Mode == ServiceWatch {
+		args = append(args, "watch")
+		if s.Interval > 0 {
+			args = append(args, "--interval", s.Interval.String())
+		}
+		return args
+	}
+	return append(args, "reconcile")
+}
+
+func (s ServiceSpec) envKeys() []string {
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SystemdUnits generates the systemd user units for spec in unitDir
+func SystemdUnits(spec ServiceSpec, unitDir string) ([]ServiceFile, error) {
+	var svc strings.Builder
+	svc.WriteString("# Generated by agents service install; changes are overwritten on reinstall.\n")
+	svc.WriteString("[Unit]\n")
+	switch spec.Mode {
+	case ServiceWatch:
+		svc.WriteString("Description=Agent Smith: keep the active persona applied (agents watch)\n")
+	case ServiceTimer, ServicePath:
+		svc.WriteString("Description=Agent Smith: reapply the active persona (agents reconcile)\n")
+	default:
+		return nil, fmt.Errorf("unknown service mode %q (expected watch, timer or path)", spec.Mode)
+	}
+	svc.WriteString("\n[Service]\n")
+	if spec.Mode == ServiceWatch {
+		svc.WriteString("Type=simple\n")
+	} else {
+		svc.WriteString("Type=oneshot\n")
+	}
+	for _, k := range spec.envKeys() {
+		svc.WriteString("Environment=" + systemdQuote(k+"="+spec.Env[k]) + "\n")
+	}
+	var args []string
+	for _, a := range spec.command() {
+		args = append(args, systemdExecQuote(a))
+	}
+	svc.WriteString("ExecStart=" + strings.Join(args, " ") + "\n")
+	if spec.Mode == ServiceWatch {
+		svc.WriteString("Restart=on-failure\nRestartSec=5\n")
+		svc.WriteString("\n[Install]\nWantedBy=default.target\n")
+	}
+
+	files := []ServiceFile{{Path: filepath.Join(unitDir, ServiceName+".service"), Content: svc.String()}}
+
+	switch spec.Mode {
+	case ServiceTimer:
+		interval := spec.Interval
+		if interval <= 0 {
+			return nil, fmt.Errorf("the timer mode needs an interval")
+		}
+		files = append(files, ServiceFile{
+			Path: filepath.Join(unitDir, ServiceName+".timer"),
+			Content: "# Generated by agents service install; changes are overwritten on reinstall.\n" +
+				"[Unit]\nDescription=Agent Smith: reapply the active persona every " + interval.String() + "\n" +
+				"\n[Timer]\nOnStartupSec=1min\nOnUnitActiveSec=" + systemdDuration(interval) + "\nUnit=" + ServiceName + ".service\n" +
+				"\n[Install]\nWantedBy=timers.target\n",
+		})
+	case ServicePath:
+		if len(spec.WatchPaths) == 0 {
+			return nil, fmt.Errorf("the path mode needs paths to watch")
+		}
+		var p strings.Builder
+		p.WriteString("# Generated by agents service install; changes are overwritten on reinstall.\n")
+		p.WriteString("[Unit]\nDescription=Agent Smith: reapply the active persona when personas or targets change\n")
+		p.WriteString("\n[Path]\n")
+		for _, w := range spec.WatchPaths {
+			p.WriteString("PathChanged=" + systemdQuote(w) + "\n")
+		}
+		p.WriteString("Unit=" + ServiceName + ".service\n")
+		p.WriteString("\n[Install]\nWantedBy=default.target\n")
+		files = append(files, ServiceFile{Path: filepath.Join(unitDir, ServiceName+".path"), Content: p.String()})
+	}
+	return files, nil
+}
+
+// SystemdEnableUnit is the unit to enable for a mode
+func SystemdEnableUnit(mode string) string {
+	switch mode {
+	case ServiceTimer:
+		return ServiceName + ".timer"
+	case ServicePath:
+		return ServiceName + ".path"
+	}
+	return ServiceName + ".service"
+}
+
+// LaunchdPlist generates the launchd agent for spec in agentsDir (~/Library/LaunchAgents)
+func LaunchdPlist(spec ServiceSpec, launchAgentsDir string) (ServiceFile, error) {
+	var b bytes.Buffer
+	str := func(s string) string {
+		var e bytes.Buffer
+		xml.EscapeText(&e, []byte(s))
+		return "<string>" + e.String() + "</string>"
+	}
+
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<!-- Generated by agents service install; changes are overwritten on reinstall. -->
+<plist version="1.0">
+<dict>
+`)
+	b.WriteString("\t<key>Label</key>\n\t" + str(ServiceName) + "\n")
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range spec.command() {
+		b.WriteString("\t\t" + str(a) + "\n")
+	}
+	b.WriteString("\t</array>\n")
+	if len(spec.Env) > 0 {
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, k := range spec.envKeys() {
+			b.WriteString("\t\t<key>" + k + "</key>\n\t\t" + str(spec.Env[k]) + "\n")
+		}
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+
+	switch spec.Mode {
+	case ServiceWatch:
+		b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	case ServiceTimer:
+		if spec.Interval < time.Second {
+			return ServiceFile{}, fmt.Errorf("the timer mode needs an interval of at least 1s")
+		}
+		b.WriteString(fmt.Sprintf("\t<key>StartInterval</key>\n\t<integer>%d</integer>\n", int(spec.Interval.Seconds())))
+	case ServicePath:
+		if len(spec.WatchPaths) == 0 {
+			return ServiceFile{}, fmt.Errorf("the path mode needs paths to watch")
+		}
+		b.WriteString("\t<key>WatchPaths</key>\n\t<array>\n")
+		for _, w := range spec.WatchPaths {
+			b.WriteString("\t\t" + str(w) + "\n")
+		}
+		b.WriteString("\t</array>\n")
+	default:
+		return ServiceFile{}, fmt.Errorf("unknown service mode %q (expected watch, timer or path)", spec.Mode)
+	}
+
+	if spec.LogPath != "" {
+		b.WriteString("\t<key>StandardOutPath</key>\n\t" + str(spec.LogPath) + "\n")
+		b.WriteString("\t<key>StandardErrorPath</key>\n\t" + str(spec.LogPath) + "\n")
+	}
+	b.WriteString("</dict>\n</plist>\n")
+
+	return ServiceFile{Path: filepath.Join(launchAgentsDir, ServiceName+".plist"), Content: b.String()}, nil
+}
+
+// systemdQuote quotes a word of a unit file setting: specifiers are escaped and
+// words with spaces, quotes or backslashes are double-quoted
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if !strings.ContainsAny(s, " \t\"';\\") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// systemdExecQuote quotes a word of ExecStart, where "$" also starts a variable
+// expansion and is escaped as "$$"; other settings take "$" literally
+func systemdExecQuote(s string) string {
+	return systemdQuote(strings.ReplaceAll(s, "$", "$$"))
+}
+
+// systemdDuration formats d as a systemd time span
+func systemdDuration(d time.Duration) string {
+	if d%time.Second != 0 {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%ds", int64(d.Seconds()))
+}
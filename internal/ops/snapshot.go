@@ -0,0 +1,103 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// snapshot is what a path held before apply changed it, so it can be put back
+type snapshot struct {
+	path    string
+	exists  bool
+	isDir   bool
+	link    string // symlink destination, if the path was a link
+	content []byte
+	mode    os.FileMode
+}
+
+// takeSnapshot records the current state of path
+func takeSnapshot(path string) (*snapshot, error) {
+	s := &snapshot{path: path}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s before apply: %w", path, err)
+	}
+	s.exists = true
+	s.mode = info.Mode().Perm()
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if s.link, err = os.Readlink(path); err != nil {
+			return nil, fmt.Errorf("error reading link %s before apply: %w", path, err)
+		}
+	case info.IsDir():
+		s.isDir = true
+	default:
+		if s.content, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading %s before apply: %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+// unchanged reports whether the path still holds what the snapshot recorded
+func (s *snapshot) unchanged() bool {
+	info, err := os.Lstat(s.path)
+	if err != nil {
+		return !s.exists && os.IsNotExist(err)
+	}
+	if !s.exists {
+		return false
+	}
+	switch {
+	case s.isDir:
+		return info.IsDir()
+	case s.link != "":
+		dest, err := os.Readlink(s.path)
+		return err == nil && dest == s.link
+	case info.Mode()&os.ModeSymlink != 0 || info.IsDir():
+		return false
+	}
+	content, err := os.ReadFile(s.path)
+	return err == nil && bytes.Equal(content, s.content) && info.Mode().Perm() == s.mode
+}
+
+// restore puts the path back the way it was when the snapshot was taken
+func (s *snapshot) restore() error {
+	if s.unchanged() {
+		return nil
+	}
+	if s.isDir {
+		// Directories are never replaced by apply; recreate one that was removed while empty
+		return os.MkdirAll(s.path, s.mode)
+	}
+
+	if _, err := os.Lstat(s.path); err == nil {
+		if err := os.Remove(s.path); err != nil {
+			return fmt.Errorf("error removing %s: %w", s.path, err)
+		}
+	}
+
+	switch {
+	case !s.exists:
+		return nil
+	case s.link != "":
+		if err := os.Symlink(s.link, s.path); err != nil {
+			return fmt.Errorf("error restoring link %s: %w", s.path, err)
+		}
+	default:
+		if err := writeFileAtomic(io.Discard, s.path, s.content); err != nil {
+			return err
+		}
+		if err := os.Chmod(s.path, s.mode); err != nil {
+			return fmt.Errorf("error restoring permissions of %s: %w", s.path, err)
+		}
+	}
+	return nil
+}
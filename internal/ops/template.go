@@ -0,0 +1,118 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"agent-smith/internal/config"
+)
+
+// TemplateData is the data available to persona templates
+type TemplateData struct {
+	Vars    map[string]string
+	Env     map[string]string
+	Host    string
+	Persona string
+	Target  TemplateTarget
+}
+
+// TemplateTarget describes the target a persona is being rendered for
+type TemplateTarget struct {
+	Path string
+	Mode config.TargetMode
+}
+
+// NewTemplateData builds the template data for rendering a persona into a target
+func NewTemplateData(persona string, target config.TargetConfig, vars map[string]string) TemplateData {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	host, _ := os.Hostname()
+
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	mode := target.Mode
+	if mode == "" {
+		mode = config.TargetModeLink
+	}
+
+	return TemplateData{
+		Vars:    vars,
+		Env:     env,
+		Host:    host,
+		Persona: persona,
+		Target: TemplateTarget{
+			Path: ExpandPath(target.Path),
+			Mode: mode,
+		},
+	}
+}
+
+// RenderTemplate executes the persona content as a Go text/template.
+// Personas opt in with `template: true` in their frontmatter; others are returned unchanged.
+func RenderTemplate(p *Persona, data TemplateData) ([]byte, error) {
+	if p.Meta.Template == nil || !*p.Meta.Template {
+		return p.Content, nil
+	}
+
+	tmpl, err := template.New(p.Path).Option("missingkey=zero").Parse(string(p.Content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing persona template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("error rendering persona template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderForTarget returns the content persona produces for target (includes, inheritance and templates resolved,
+// plus the ownership marker if the target asks for one)
+func RenderForTarget(persona string, agentsDirs []string, target config.TargetConfig, vars map[string]string) ([]byte, error) {
+	p, err := LoadPersona(persona, agentsDirs)
+	if err != nil {
+		return nil, err
+	}
+	content, err := RenderTemplate(p, NewTemplateData(persona, target, vars))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Path, err)
+	}
+	if target.Marker && target.Mode == config.TargetModeCopy {
+		content = AddMarker(persona, content)
+	}
+	return content, nil
+}
+
+// ParseVars parses key=value pairs (as given to --set)
+func ParseVars(pairs []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid variable %q (expected key=value)", pair)
+		}
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// MergeVars returns a new map with the entries of each map, later maps taking precedence
+func MergeVars(maps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
@@ -1,6 +1,8 @@
 package ops
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 )
@@ -17,3 +19,18 @@ func ExpandPath(path string) string {
 	}
 	return path
 }
+
+// HashContent returns the hex encoded SHA-256 of content
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the hex encoded SHA-256 of the file at path (following symlinks)
+func HashFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return HashContent(content), nil
+}
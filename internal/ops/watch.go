@@ -0,0 +1,70 @@
+package ops
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileStamp is what polling compares to notice that a path changed
+type FileStamp struct {
+	Exists  bool
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+	// Link is the destination of a symlink
+	Link string
+}
+
+// StampPaths records the current stamp of every path (symlinks are not followed)
+func StampPaths(paths []string) map[string]FileStamp {
+	stamps := make(map[string]FileStamp, len(paths))
+	for _, path := range paths {
+		var s FileStamp
+		if info, err := os.Lstat(path); err == nil {
+			s = FileStamp{Exists: true, Mode: info.Mode(), Size: info.Size(), ModTime: info.ModTime()}
+			if info.Mode()&os.ModeSymlink != 0 {
+				s.Link, _ = os.Readlink(path)
+			}
+		}
+		stamps[path] = s
+	}
+	return stamps
+}
+
+// ChangedPaths lists the paths whose stamp differs between before and after, sorted
+func ChangedPaths(before, after map[string]FileStamp) []string {
+	var changed []string
+	for path, s := range after {
+		if prev, ok := before[path]; !ok || !prev.ModTime.Equal(s.ModTime) || prev.Exists != s.Exists ||
+			prev.Mode != s.Mode || prev.Size != s.Size || prev.Link != s.Link {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// PersonaSourceFiles lists the files under the persona directories (personas and the files they include)
+func PersonaSourceFiles(agentsDirs []string) []string {
+	var files []string
+	for _, dir := range agentsDirs {
+		filepath.WalkDir(ExpandPath(dir), func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if !d.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	return files
+}
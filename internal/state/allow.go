@@ -0,0 +1,82 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-smith/internal/config"
+)
+
+// AllowedPath returns the file listing the projects the shell hook may sync (agents allow)
+func AllowedPath() (string, error) {
+	stateHome, err := config.GetStateHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateHome, "agent-smith", "allowed.yaml"), nil
+}
+
+// LoadAllowed returns the allowed projects: for each project directory, the hash of its
+// configuration when it was allowed (see config.Pin.Hash)
+func LoadAllowed() (map[string]string, error) {
+	allowed := make(map[string]string)
+	path, err := AllowedPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return allowed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &allowed); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if allowed == nil {
+		allowed = make(map[string]string)
+	}
+	return allowed, nil
+}
+
+// Allow records that the project in dir, configured as hash, may be synced by the shell hook
+func Allow(dir, hash string) error {
+	allowed, err := LoadAllowed()
+	if err != nil {
+		return err
+	}
+	allowed[dir] = hash
+	return saveAllowed(allowed)
+}
+
+// Deny removes the project in dir from the allowed projects. It reports whether it was allowed.
+func Deny(dir string) (bool, error) {
+	allowed, err := LoadAllowed()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := allowed[dir]; !ok {
+		return false, nil
+	}
+	delete(allowed, dir)
+	return true, saveAllowed(allowed)
+}
+
+func saveAllowed(allowed map[string]string) error {
+	path, err := AllowedPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(allowed)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-smith/internal/config"
+)
+
+// HistoryEntry records a persona activation in the history log
+type HistoryEntry struct {
+	Time      time.Time `json:"time" yaml:"time"`
+	Persona   string    `json:"persona" yaml:"persona"`
+	AgentFile string    `json:"agent_file,omitempty" yaml:"agent_file,omitempty"`
+	Targets   []string  `json:"targets" yaml:"targets"`
+	Host      string    `json:"host,omitempty" yaml:"host,omitempty"`
+	Command   string    `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+// HistoryPath returns the append-only activation log (one JSON object per line)
+func HistoryPath() (string, error) {
+	stateHome, err := config.GetStateHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateHome, "agent-smith", "history.jsonl"), nil
+}
+
+// AppendHistory adds entry to the end of the history log
+func AppendHistory(entry HistoryEntry) error {
+	path, err := HistoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadHistory reads the history log, oldest entry first. A missing log is empty.
+// Lines that cannot be parsed (e.g. a write cut short) are skipped.
+func LoadHistory() ([]HistoryEntry, error) {
+	path, err := HistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// PreviousPersona returns the most recently activated persona other than current, like `cd -`
+func PreviousPersona(entries []HistoryEntry, current string) (HistoryEntry, bool) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Persona != "" && entries[i].Persona != current {
+			return entries[i], true
+		}
+	}
+	return HistoryEntry{}, false
+}
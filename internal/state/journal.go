@@ -0,0 +1,364 @@
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"agent-smith/internal/config"
+)
+
+// DefaultJournalRetention is the number of journal entries kept when the config does not say
+const DefaultJournalRetention = 10
+
+// journalEntryFile is the description of an entry inside its directory
+const journalEntryFile = "entry.yaml"
+
+// journalStateFile is the copy of the status file taken before the command ran
+const journalStateFile = "status.yaml"
+
+// JournalFile is what a path held before a command changed it
+type JournalFile struct {
+	Path   string `yaml:"path"`
+	Exists bool   `yaml:"exists"`
+	// Link is the symlink destination, if the path was a link
+	Link string `yaml:"link,omitempty"`
+	// Content is the name of the file (inside the entry directory) holding the previous content
+	Content string      `yaml:"content,omitempty"`
+	Mode    os.FileMode `yaml:"mode,omitempty"`
+
+	data []byte
+}
+
+// JournalEntry records what a mutating command changed so that it can be undone
+type JournalEntry struct {
+	ID      string        `yaml:"id"`
+	Time    time.Time     `yaml:"time"`
+	Command string        `yaml:"command"`
+	Files   []JournalFile `yaml:"files"`
+	// HadState is false if there was no status file before the command
+	HadState bool `yaml:"had_state"`
+	// StateHash is the SHA-256 of the status file after the command, to detect later changes
+	StateHash string `yaml:"state_hash"`
+
+	dir       string
+	stateData []byte
+}
+
+// JournalDir returns the directory journal entries are kept in
+func JournalDir() (string, error) {
+	stateHome, err := config.GetStateHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateHome, "agent-smith", "journal"), nil
+}
+
+// BeginJournal starts recording a command. The current status file is kept so undo can put it back.
+func BeginJournal(command string) (*JournalEntry, error) {
+	path, err := getStatusFilePath()
+	if err != nil {
+		return nil, err
+	}
+	j := &JournalEntry{Time: time.Now().UTC(), Command: command}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		j.HadState = true
+		j.stateData = data
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	return j, nil
+}
+
+// Record saves what path holds now, before the command changes it.
+// Only the first record of a path counts. Recording on a nil journal does nothing.
+func (j *JournalEntry) Record(path string) error {
+	if j == nil {
+		return nil
+	}
+	for _, f := range j.Files {
+		if f.Path == path {
+			return nil
+		}
+	}
+
+	f := JournalFile{Path: path}
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	case info.Mode()&os.ModeSymlink != 0:
+		f.Exists = true
+		if f.Link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	case info.IsDir():
+		return fmt.Errorf("cannot journal directory %s", path)
+	default:
+		f.Exists = true
+		f.Mode = info.Mode().Perm()
+		if f.data, err = os.ReadFile(path); err != nil {
+			return err
+		}
+		f.Content = "file-" + strconv.Itoa(len(j.Files))
+	}
+	j.Files = append(j.Files, f)
+	return nil
+}
+
+// Commit writes the entry to the journal and drops the oldest entries beyond retention.
+// Nothing is written if the command changed nothing. Committing a nil journal does nothing.
+func (j *JournalEntry) Commit(retention int) error {
+	if j == nil {
+		return nil
+	}
+	path, err := getStatusFilePath()
+	if err != nil {
+		return err
+	}
+	after, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(j.Files) == 0 && j.HadState == (err == nil) && bytes.Equal(after, j.stateData) {
+		return nil
+	}
+	j.StateHash = hashBytes(after)
+
+	root, err := JournalDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(root, j.Time.Format("20060102-150405.000000000")+"-")
+	if err != nil {
+		return err
+	}
+	j.dir = dir
+	j.ID = filepath.Base(dir)
+
+	if j.HadState {
+		if err := os.WriteFile(filepath.Join(dir, journalStateFile), j.stateData, 0600); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+	}
+	for _, f := range j.Files {
+		if f.Content == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.Content), f.data, 0600); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+	}
+	data, err := yaml.Marshal(j)
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, journalEntryFile), data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	return PruneJournal(retention)
+}
+
+// LoadJournal returns the journal entries, oldest first
+func LoadJournal() ([]*JournalEntry, error) {
+	root, err := JournalDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []*JournalEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, d.Name())
+		data, err := os.ReadFile(filepath.Join(dir, journalEntryFile))
+		if err != nil {
+			// An entry whose commit was interrupted
+			continue
+		}
+		var j JournalEntry
+		if err := yaml.Unmarshal(data, &j); err != nil {
+			continue
+		}
+		j.dir = dir
+		j.ID = d.Name()
+		entries = append(entries, &j)
+	}
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].ID < entries[b].ID })
+	return entries, nil
+}
+
+// PruneJournal removes the oldest entries so that at most retention remain
+func PruneJournal(retention int) error {
+	entries, err := LoadJournal()
+	if err != nil {
+		return err
+	}
+	if retention < 0 {
+		retention = 0
+	}
+	for i := 0; i < len(entries)-retention; i++ {
+		if err := entries[i].Remove(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove deletes the entry from the journal
+func (j *JournalEntry) Remove() error {
+	if j.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(j.dir)
+}
+
+// Conflicts lists what changed since the command ran: paths that hold something
+// other than what the command left (nothing), and the status file
+func (j *JournalEntry) Conflicts() ([]string, error) {
+	var conflicts []string
+	for _, f := range j.Files {
+		if _, err := os.Lstat(f.Path); err == nil {
+			if same, _ := j.restored(f); !same {
+				conflicts = append(conflicts, f.Path)
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	path, err := getStatusFilePath()
+	if err != nil {
+		return nil, err
+	}
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if hashBytes(current) != j.StateHash {
+		conflicts = append(conflicts, path)
+	}
+	return conflicts, nil
+}
+
+// Undo puts every recorded path and the status file back the way they were before the command,
+// replacing whatever is there now, and removes the entry from the journal
+func (j *JournalEntry) Undo() error {
+	for _, f := range j.Files {
+		if err := j.restoreFile(f); err != nil {
+			return err
+		}
+	}
+
+	path, err := getStatusFilePath()
+	if err != nil {
+		return err
+	}
+	if j.HadState {
+		data, err := os.ReadFile(filepath.Join(j.dir, journalStateFile))
+		if err != nil {
+			return fmt.Errorf("journal entry %s is incomplete: %w", j.ID, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	} else if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return j.Remove()
+}
+
+// restored reports whether f.Path already holds what was recorded
+func (j *JournalEntry) restored(f JournalFile) (bool, error) {
+	info, err := os.Lstat(f.Path)
+	if err != nil {
+		return !f.Exists && errors.Is(err, os.ErrNotExist), nil
+	}
+	if !f.Exists {
+		return false, nil
+	}
+	if f.Link != "" {
+		dest, err := os.Readlink(f.Path)
+		return err == nil && dest == f.Link, nil
+	}
+	if !info.Mode().IsRegular() {
+		return false, nil
+	}
+	want, err := os.ReadFile(filepath.Join(j.dir, f.Content))
+	if err != nil {
+		return false, err
+	}
+	got, err := os.ReadFile(f.Path)
+	return err == nil && bytes.Equal(got, want) && info.Mode().Perm() == f.Mode, nil
+}
+
+func (j *JournalEntry) restoreFile(f JournalFile) error {
+	if same, err := j.restored(f); err != nil || same {
+		return err
+	}
+	var content []byte
+	if f.Exists && f.Link == "" {
+		var err error
+		if content, err = os.ReadFile(filepath.Join(j.dir, f.Content)); err != nil {
+			return fmt.Errorf("journal entry %s is incomplete: %w", j.ID, err)
+		}
+	}
+
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error removing %s: %w", f.Path, err)
+	}
+	if !f.Exists {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+		return err
+	}
+	if f.Link != "" {
+		if err := os.Symlink(f.Link, f.Path); err != nil {
+			return fmt.Errorf("error restoring link %s: %w", f.Path, err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(f.Path, content, f.Mode); err != nil {
+		return fmt.Errorf("error restoring %s: %w", f.Path, err)
+	}
+	// WriteFile leaves the permissions of an existing file and applies the umask
+	return os.Chmod(f.Path, f.Mode)
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"errors"
+	"time"
+)
+
+// StackEntry is a persona saved by `agents push`, with the targets and variables it was applied with
+type StackEntry struct {
+	Persona   string            `yaml:"persona"`
+	AgentFile string            `yaml:"agent_file,omitempty"`
+	Targets   []TargetState     `yaml:"targets"`
+	Vars      map[string]string `yaml:"vars,omitempty"`
+	PushedAt  time.Time         `yaml:"pushed_at"`
+	// Over is the persona that was activated on top of this one
+	Over string `yaml:"over,omitempty"`
+	// Expires is when Over ends and this persona comes back (`use --for`); zero if it does not expire
+	Expires time.Time `yaml:"expires,omitempty"`
+	// OverTargets are the targets Over was applied to, so pop can remove those this persona does not have
+	OverTargets []TargetState `yaml:"over_targets,omitempty"`
+}
+
+// Expired reports whether the persona on top of this entry has run out of time
+func (e StackEntry) Expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires)
+}
+
+// ErrStackEmpty is returned when popping an empty persona stack
+var ErrStackEmpty = errors.New("persona stack is empty")
+
+// PushStack saves entry on top of the persona stack
+func PushStack(entry StackEntry) error {
+	state, err := LoadState()
+	if err != nil || state == nil {
+		state = &StatusState{}
+	}
+	state.Stack = append(state.Stack, entry)
+	return WriteState(state)
+}
+
+// PeekStack returns the entry on top of the persona stack
+func PeekStack() (StackEntry, error) {
+	state, err := LoadState()
+	if err != nil || state == nil || len(state.Stack) == 0 {
+		return StackEntry{}, ErrStackEmpty
+	}
+	return state.Stack[len(state.Stack)-1], nil
+}
+
+// PopStack removes the entry on top of the persona stack and returns it
+func PopStack() (StackEntry, error) {
+	state, err := LoadState()
+	if err != nil || state == nil || len(state.Stack) == 0 {
+		return StackEntry{}, ErrStackEmpty
+	}
+	top := state.Stack[len(state.Stack)-1]
+	state.Stack = state.Stack[:len(state.Stack)-1]
+	return top, WriteState(state)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -12,19 +13,47 @@ import (
 )
 
 type TargetState struct {
-	Path string            `yaml:"path"`
-	Mode config.TargetMode `yaml:"mode"`
+	Path   string            `yaml:"path"`
+	Mode   config.TargetMode `yaml:"mode"`
+	Render bool              `yaml:"render,omitempty"`
+	Marker bool              `yaml:"marker,omitempty"`
+	// Variants is the variants table of the target config, kept so reconcile applies the same variants
+	Variants map[string]string `yaml:"variants,omitempty"`
+	// Variant is the persona the target was applied with when it differs from the agent file's persona
+	Variant string `yaml:"variant,omitempty"`
+	// LinkDest is where a link target pointed when it was written (ownership evidence)
+	LinkDest string `yaml:"link_dest,omitempty"`
+	// Hash is the SHA-256 of the content written (copy and rendered link targets)
+	Hash string `yaml:"hash,omitempty"`
+	// SourceHash is the SHA-256 of the resolved persona at apply time
+	SourceHash string `yaml:"source_hash,omitempty"`
+	// SourceModTime is the latest modification time of the persona files at apply time
+	SourceModTime time.Time `yaml:"source_mtime,omitempty"`
+	// Pinned is set for the targets of a pinned project written by sync; they stay tracked
+	// when the agent file is applied again to the user's targets (see RecordAgentFile)
+	Pinned bool `yaml:"pinned,omitempty"`
 }
 
 type AgentFileState struct {
-	Name    string        `yaml:"name"` // Determine if we still need "Name" (persona label). User said: "name (persona label)"
-	Path    string        `yaml:"path"` // The actual agent_file path
-	Targets []TargetState `yaml:"targets"`
+	Name    string            `yaml:"name"` // Determine if we still need "Name" (persona label). User said: "name (persona label)"
+	Path    string            `yaml:"path"` // The actual agent_file path
+	Targets []TargetState     `yaml:"targets"`
+	Vars    map[string]string `yaml:"vars,omitempty"` // Template variables given on the command line (--set)
+}
+
+// BackupState records an unmanaged file that was moved aside before a target was written
+type BackupState struct {
+	Path      string    `yaml:"path"`   // Original location of the file
+	Backup    string    `yaml:"backup"` // Where the file is kept until restored
+	CreatedAt time.Time `yaml:"created_at"`
 }
 
 type StatusState struct {
 	CanonicalTarget string           `yaml:"canonical_target,omitempty"`
 	AgentFiles      []AgentFileState `yaml:"agent_files"`
+	Backups         []BackupState    `yaml:"backups,omitempty"`
+	// Stack holds the personas saved by `agents push`, the last one on top
+	Stack []StackEntry `yaml:"stack,omitempty"`
 }
 
 func getStatusFilePath() (string, error) {
@@ -41,6 +70,25 @@ func getStatusFilePath() (string, error) {
 	return filepath.Join(stateHome, "agent-smith", "status.yaml"), nil
 }
 
+// BackupDir returns the directory unmanaged files are moved to before being replaced
+func BackupDir() (string, error) {
+	stateHome, err := config.GetStateHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateHome, "agent-smith", "backups"), nil
+}
+
+// RecordBackup adds a backup entry to the state file
+func RecordBackup(backup BackupState) error {
+	state, err := LoadState()
+	if err != nil || state == nil {
+		state = &StatusState{}
+	}
+	state.Backups = append(state.Backups, backup)
+	return WriteState(state)
+}
+
 func LoadState() (*StatusState, error) {
 	path, err := getStatusFilePath()
 	if err != nil {
@@ -61,6 +109,37 @@ func LoadState() (*StatusState, error) {
 }
 
 func SaveState(canonicalTarget, personaName, agentFile string, targets []config.TargetConfig) error {
+	return RecordAgentFile(canonicalTarget, AgentFileState{
+		Name:    personaName,
+		Path:    agentFile,
+		Targets: TargetStates(targets),
+	})
+}
+
+// TargetConfig returns the configuration the target was applied with
+func (t TargetState) TargetConfig() config.TargetConfig {
+	return config.TargetConfig{Path: t.Path, Mode: t.Mode, Render: t.Render, Marker: t.Marker, Variants: t.Variants}
+}
+
+// TargetStates converts config targets to state targets
+func TargetStates(targets []config.TargetConfig) []TargetState {
+	var stateTargets []TargetState
+	for _, t := range targets {
+		stateTargets = append(stateTargets, TargetState{
+			Path:     t.Path,
+			Mode:     t.Mode,
+			Render:   t.Render,
+			Marker:   t.Marker,
+			Variants: t.Variants,
+		})
+	}
+	return stateTargets
+}
+
+// RecordAgentFile stores the result of applying an agent file, replacing any
+// previous entry for the same agent file path. Pinned targets of the previous entry are
+// kept: they belong to a project synced to the persona, not to the targets just applied.
+func RecordAgentFile(canonicalTarget string, agentFile AgentFileState) error {
 	// Load existing state to preserve other agent files
 	state, err := LoadState()
 	if err != nil {
@@ -72,51 +151,84 @@ func SaveState(canonicalTarget, personaName, agentFile string, targets []config.
 
 	state.CanonicalTarget = canonicalTarget
 
-	// Convert config targets to state targets
-	var stateTargets []TargetState
-	for _, t := range targets {
-		stateTargets = append(stateTargets, TargetState{
-			Path: t.Path,
-			Mode: t.Mode,
-		})
-	}
-
 	// Update or Append AgentFile
 	found := false
 	for i, af := range state.AgentFiles {
 		// Key by AgentFile Path
-		if af.Path == agentFile {
-			state.AgentFiles[i].Name = personaName     // Update label if it changed
-			state.AgentFiles[i].Targets = stateTargets // Replace targets (Authority: "use" command)
+		if af.Path == agentFile.Path {
+			agentFile.Targets = keepPinned(af.Targets, agentFile.Targets)
+			state.AgentFiles[i] = agentFile // Replace targets (Authority: "use" command)
 			found = true
 			break
 		}
 	}
-	if !found && agentFile != "" {
-		state.AgentFiles = append(state.AgentFiles, AgentFileState{
-			Name:    personaName,
-			Path:    agentFile,
-			Targets: stateTargets,
-		})
+	if !found && agentFile.Path != "" {
+		state.AgentFiles = append(state.AgentFiles, agentFile)
 	}
 
-	path, err := getStatusFilePath()
-	if err != nil {
-		return err
+	return WriteState(state)
+}
+
+// keepPinned returns targets with the pinned targets of previous added. A pinned target
+// applied again stays pinned.
+func keepPinned(previous, targets []TargetState) []TargetState {
+	pinned := make(map[string]bool)
+	for _, t := range previous {
+		if t.Pinned {
+			pinned[t.Path] = true
+		}
+	}
+	if len(pinned) == 0 {
+		return targets
 	}
+	for i := range targets {
+		if pinned[targets[i].Path] {
+			targets[i].Pinned = true
+			delete(pinned, targets[i].Path)
+		}
+	}
+	for _, t := range previous {
+		if pinned[t.Path] {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
 
-	// Ensure directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+// TrackTargets records targets for an agent file without touching its other targets.
+// The targets are no longer tracked for any other agent file.
+func TrackTargets(agentFile AgentFileState, targets []TargetState) error {
+	state, err := LoadState()
+	if err != nil || state == nil {
+		state = &StatusState{}
 	}
 
-	data, err := yaml.Marshal(&state)
-	if err != nil {
-		return err
+	paths := make(map[string]bool)
+	for _, t := range targets {
+		paths[t.Path] = true
 	}
 
-	return os.WriteFile(path, data, 0644)
+	found := false
+	for i := range state.AgentFiles {
+		af := &state.AgentFiles[i]
+		var kept []TargetState
+		for _, t := range af.Targets {
+			if !paths[t.Path] {
+				kept = append(kept, t)
+			}
+		}
+		af.Targets = kept
+		if af.Path == agentFile.Path {
+			af.Targets = append(af.Targets, targets...)
+			found = true
+		}
+	}
+	if !found {
+		agentFile.Targets = targets
+		state.AgentFiles = append(state.AgentFiles, agentFile)
+	}
+
+	return WriteState(state)
 }
 
 // WriteState saves the given state to the status file.
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -173,3 +174,191 @@ func TestSaveStateReplacesTargets(t *testing.T) {
 		t.Errorf("Expected target %s, got %s", target2, af.Targets[0].Path)
 	}
 }
+
+func TestRecordAgentFileKeepsPinnedTargets(t *testing.T) {
+	tempDir := t.TempDir()
+	os.Setenv("XDG_STATE_HOME", filepath.Join(tempDir, "state"))
+	defer os.Unsetenv("XDG_STATE_HOME")
+
+	viper.Reset()
+	viper.SetConfigFile("")
+
+	agentFile := AgentFileState{Name: "coder", Path: "/tmp/agents/AGENTS.coder.md"}
+	if err := RecordAgentFile("/tmp/AGENTS.md", AgentFileState{Name: "coder", Path: agentFile.Path, Targets: []TargetState{{Path: "/tmp/AGENTS.md"}}}); err != nil {
+		t.Fatal(err)
+	}
+	// sync tracks the targets of a pinned project under the same agent file
+	if err := TrackTargets(agentFile, []TargetState{{Path: "/tmp/project/AGENTS.md", Pinned: true}, {Path: "/tmp/project/CLAUDE.md", Pinned: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// use applies it again, including one of the project targets
+	if err := RecordAgentFile("/tmp/AGENTS.md", AgentFileState{Name: "coder", Path: agentFile.Path, Targets: []TargetState{{Path: "/tmp/AGENTS.md"}, {Path: "/tmp/project/CLAUDE.md", Hash: "new"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := LoadState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := st.AgentFiles[0].Targets
+	if len(targets) != 3 {
+		t.Fatalf("Expected the pinned targets to stay tracked, got %+v", targets)
+	}
+	if targets[1].Path != "/tmp/project/CLAUDE.md" || targets[1].Hash != "new" || !targets[1].Pinned {
+		t.Errorf("Expected the reapplied pinned target updated and still pinned, got %+v", targets[1])
+	}
+	if targets[2].Path != "/tmp/project/AGENTS.md" || !targets[2].Pinned {
+		t.Errorf("Expected the other pinned target kept, got %+v", targets[2])
+	}
+}
+
+func TestHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	entries, err := LoadHistory()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty history, got %v, %v", entries, err)
+	}
+
+	for _, p := range []string{"coder", "writer", "writer"} {
+		if err := AppendHistory(HistoryEntry{Persona: p, Targets: []string{"/tmp/AGENTS.md"}, Command: "agents use " + p}); err != nil {
+			t.Fatalf("AppendHistory failed: %v", err)
+		}
+	}
+
+	// A truncated line does not hide the rest of the log
+	path, _ := HistoryPath()
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString("{\"persona\": \"trunc\n")
+	f.Close()
+	AppendHistory(HistoryEntry{Persona: "reviewer"})
+
+	entries, err = LoadHistory()
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %v", err)
+	}
+	if len(entries) != 4 || entries[0].Persona != "coder" || entries[3].Persona != "reviewer" {
+		t.Fatalf("unexpected history: %+v", entries)
+	}
+
+	if prev, ok := PreviousPersona(entries, "reviewer"); !ok || prev.Persona != "writer" {
+		t.Errorf("PreviousPersona(reviewer) = %+v, %v; want writer", prev, ok)
+	}
+	if prev, ok := PreviousPersona(entries[:3], "writer"); !ok || prev.Persona != "coder" {
+		t.Errorf("PreviousPersona(writer) = %+v, %v; want coder", prev, ok)
+	}
+	if _, ok := PreviousPersona(entries[:1], "coder"); ok {
+		t.Errorf("expected no previous persona")
+	}
+}
+
+func TestJournal(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	viper.Reset()
+	viper.SetConfigFile("")
+	defer viper.Reset()
+
+	link := filepath.Join(tempDir, "AGENTS.md")
+	file := filepath.Join(tempDir, "CLAUDE.md")
+	os.Symlink("/personas/AGENTS.coder.md", link)
+	os.WriteFile(file, []byte("Code."), 0640)
+	if err := WriteState(&StatusState{CanonicalTarget: link}); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := BeginJournal("agents unuse")
+	if err != nil {
+		t.Fatalf("BeginJournal failed: %v", err)
+	}
+	for _, p := range []string{link, file} {
+		if err := j.Record(p); err != nil {
+			t.Fatalf("Record(%s) failed: %v", p, err)
+		}
+		os.Remove(p)
+	}
+	WriteState(&StatusState{})
+	if err := j.Commit(DefaultJournalRetention); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	entries, err := LoadJournal()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("LoadJournal = %v, %v; want one entry", entries, err)
+	}
+	if conflicts, err := entries[0].Conflicts(); err != nil || len(conflicts) != 0 {
+		t.Fatalf("Conflicts = %v, %v; want none", conflicts, err)
+	}
+	if err := entries[0].Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+
+	if dest, _ := os.Readlink(link); dest != "/personas/AGENTS.coder.md" {
+		t.Errorf("link not restored: %q", dest)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("file not restored with its permissions: %v", err)
+	}
+	if st, _ := LoadState(); st == nil || st.CanonicalTarget != link {
+		t.Errorf("state not restored: %+v", st)
+	}
+	if entries, _ := LoadJournal(); len(entries) != 0 {
+		t.Errorf("undone entry still in the journal")
+	}
+
+	// A command that changed nothing is not journaled; retention drops the oldest entries
+	j, _ = BeginJournal("agents drop nothing")
+	j.Commit(DefaultJournalRetention)
+	for i := 0; i < 3; i++ {
+		j, _ = BeginJournal("agents drop")
+		j.Record(file)
+		os.Remove(file)
+		j.Commit(2)
+		os.WriteFile(file, []byte("Code."), 0640)
+	}
+	if entries, _ := LoadJournal(); len(entries) != 2 {
+		t.Errorf("expected 2 entries after pruning, got %d", len(entries))
+	}
+}
+
+func TestStack(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	viper.Reset()
+	viper.SetConfigFile("")
+	defer viper.Reset()
+
+	if _, err := PopStack(); err != ErrStackEmpty {
+		t.Fatalf("PopStack on empty stack = %v, want ErrStackEmpty", err)
+	}
+
+	PushStack(StackEntry{Persona: "coder", Vars: map[string]string{"team": "platform"}})
+	PushStack(StackEntry{Persona: "writer"})
+	if err := RecordAgentFile("/tmp/AGENTS.md", AgentFileState{Name: "reviewer", Path: "/tmp/AGENTS.reviewer.md"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if top, err := PeekStack(); err != nil || top.Persona != "writer" {
+		t.Fatalf("PeekStack = %+v, %v; want writer", top, err)
+	}
+	if top, err := PopStack(); err != nil || top.Persona != "writer" {
+		t.Fatalf("PopStack = %+v, %v; want writer", top, err)
+	}
+	top, err := PopStack()
+	if err != nil || top.Persona != "coder" || top.Vars["team"] != "platform" {
+		t.Fatalf("PopStack = %+v, %v; want coder with its vars", top, err)
+	}
+	if st, _ := LoadState(); len(st.Stack) != 0 || len(st.AgentFiles) != 1 {
+		t.Errorf("unexpected state after popping: %+v", st)
+	}
+
+	now := time.Now()
+	if (StackEntry{}).Expired(now) {
+		t.Errorf("an entry without expiry must never expire")
+	}
+	if !(StackEntry{Expires: now}).Expired(now) || (StackEntry{Expires: now.Add(time.Minute)}).Expired(now) {
+		t.Errorf("unexpected expiry")
+	}
+}
@@ -0,0 +1,85 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAutoRules(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644)
+
+	work := filepath.Join(tempDir, "work")
+	repo := filepath.Join(work, "api")
+	os.MkdirAll(filepath.Join(repo, ".git"), 0755)
+	os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/docs/intro\n"), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+rules:
+  - name: docs
+    dir: "%s/**"
+    branch: "docs/*"
+    persona: writer
+  - name: work
+    dir: "%s/**"
+    persona: coder
+`, agentsDir, targetFile, work, work)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	out, err := runAgentsIn(t, tempDir, repo, "auto", "--explain")
+	if err != nil {
+		t.Fatalf("auto --explain failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "docs -> writer: MATCH") || !strings.Contains(out, "Selected rule docs: persona 'writer'") {
+		t.Errorf("Expected docs rule to be selected, got:\n%s", out)
+	}
+	if _, err := os.Lstat(targetFile); !os.IsNotExist(err) {
+		t.Errorf("--explain must not switch persona")
+	}
+
+	out, err = runAgentsIn(t, tempDir, repo, "auto")
+	if err != nil {
+		t.Fatalf("auto failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected canonical target linked to writer, got %q", dest)
+	}
+
+	out, _ = runAgentsIn(t, tempDir, repo, "auto")
+	if !strings.Contains(out, "already active") {
+		t.Errorf("Expected no switch when persona is already active, got:\n%s", out)
+	}
+
+	// Off the docs branch the second rule applies
+	os.WriteFile(filepath.Join(repo, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644)
+	if out, err := runAgentsIn(t, tempDir, repo, "auto"); err != nil {
+		t.Fatalf("auto failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected canonical target linked to coder, got %q", dest)
+	}
+
+	out, _ = runAgentsIn(t, tempDir, tempDir, "auto")
+	if !strings.Contains(out, "No rule matched") {
+		t.Errorf("Expected no rule to match outside work, got:\n%s", out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Persona must be kept when no rule matches, got %q", dest)
+	}
+}
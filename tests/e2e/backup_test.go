@@ -0,0 +1,101 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupAndRestoreUnmanaged(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	handWritten := filepath.Join(tempDir, "CLAUDE.md")
+	os.WriteFile(handWritten, []byte("My own notes."), 0644)
+
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, handWritten)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	out, err := runAgentsS(t, tempDir, "use", "coder")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "Backed up unmanaged file: "+handWritten) {
+		t.Errorf("Expected backup message, got:\n%s", out)
+	}
+	if content, _ := os.ReadFile(handWritten); string(content) != "Code." {
+		t.Errorf("Expected target to hold the persona, got %q", content)
+	}
+
+	// Switching again must not back up our own copy
+	out, err = runAgentsS(t, tempDir, "use", "coder")
+	if err != nil {
+		t.Fatalf("second use failed: %v\nOutput: %s", err, out)
+	}
+	if strings.Contains(out, "Backed up") {
+		t.Errorf("Managed target should not be backed up again:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "restore")
+	if err != nil || !strings.Contains(out, handWritten) {
+		t.Errorf("Expected backup listed, got: %v\n%s", err, out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "unuse")
+	if err != nil {
+		t.Fatalf("unuse failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "agents restore "+handWritten) {
+		t.Errorf("Expected unuse to offer restore, got:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "restore", handWritten)
+	if err != nil {
+		t.Fatalf("restore failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(handWritten); string(content) != "My own notes." {
+		t.Errorf("Expected original file restored, got %q", content)
+	}
+
+	out, _ = runAgentsS(t, tempDir, "restore")
+	if !strings.Contains(out, "No backups.") {
+		t.Errorf("Expected backup to be consumed, got:\n%s", out)
+	}
+
+	// A tracked copy edited since it was written is backed up as well
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	os.WriteFile(handWritten, []byte("Edited by hand."), 0644)
+	out, err = runAgentsS(t, tempDir, "use", "coder")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "Backed up unmanaged file: "+handWritten) {
+		t.Errorf("Expected the edited copy to be backed up, got:\n%s", out)
+	}
+	if out, err := runAgentsS(t, tempDir, "restore", handWritten); err != nil {
+		t.Fatalf("restore failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(handWritten); string(content) != "Edited by hand." {
+		t.Errorf("Expected the edited copy restored, got %q", content)
+	}
+}
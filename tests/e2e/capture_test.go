@@ -0,0 +1,101 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptureAndOnConflict(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+
+	source := filepath.Join(agentsDir, "AGENTS.coder.md")
+	os.WriteFile(source, []byte("---\ndescription: Coder\n---\nCode.\n"), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	os.WriteFile(copyTarget, []byte("Code well.\n"), 0644)
+
+	// The abort policy refuses to overwrite local edits
+	out, err := runAgentsS(t, tempDir, "reconcile", "--on-conflict=abort")
+	if err == nil {
+		t.Fatalf("Expected reconcile to abort on local edits\nOutput: %s", out)
+	}
+	if content, _ := os.ReadFile(copyTarget); string(content) != "Code well.\n" {
+		t.Errorf("Abort should leave the copy untouched, got %q", content)
+	}
+
+	// Capture writes the edit back into the persona
+	out, err = runAgentsS(t, tempDir, "capture", "--yes", copyTarget)
+	if err != nil {
+		t.Fatalf("capture failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "+Code well.") {
+		t.Errorf("Expected diff preview, got:\n%s", out)
+	}
+	if content, _ := os.ReadFile(source); string(content) != "---\ndescription: Coder\n---\nCode well.\n" {
+		t.Errorf("Expected captured persona, got %q", content)
+	}
+
+	out, _ = runAgentsS(t, tempDir, "status")
+	if !strings.Contains(out, "[OK]") || strings.Contains(out, "[MODIFIED]") {
+		t.Errorf("Expected captured target to be OK, got:\n%s", out)
+	}
+
+	// Capture policy during reconcile
+	os.WriteFile(copyTarget, []byte("Code better.\n"), 0644)
+	if out, err := runAgentsS(t, tempDir, "reconcile", "--on-conflict=capture"); err != nil {
+		t.Fatalf("reconcile --on-conflict=capture failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(source); !strings.HasSuffix(string(content), "\nCode better.\n") {
+		t.Errorf("Expected reconcile to capture the edit, got %q", content)
+	}
+
+	// Overwrite policy discards local edits
+	os.WriteFile(copyTarget, []byte("Scribble.\n"), 0644)
+	if out, err := runAgentsS(t, tempDir, "reconcile", "--on-conflict=overwrite"); err != nil {
+		t.Fatalf("reconcile --on-conflict=overwrite failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(copyTarget); string(content) != "Code better.\n" {
+		t.Errorf("Expected copy overwritten, got %q", content)
+	}
+
+	// It is the default, with a warning, so that watch and the service keep repairing copies
+	if err := os.WriteFile(copyTarget, []byte("Scribble.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runAgentsS(t, tempDir, "reconcile")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "was edited locally; overwriting") {
+		t.Errorf("Expected a warning about the overwritten edits, got:\n%s", out)
+	}
+	if content, _ := os.ReadFile(copyTarget); string(content) != "Code better.\n" {
+		t.Errorf("Expected copy overwritten by default, got %q", content)
+	}
+}
@@ -0,0 +1,170 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComposedPersonaLinks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-compose")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.base.md"), []byte("# Rules\nBe careful.\n"), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("---\nextends: base\n---\n# Role\nCoder.\n"), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.plain.md"), []byte("# Role\nPlain.\n"), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.described.md"), []byte("---\ndescription: Metadata only\n---\n# Role\nDescribed.\n"), 0644)
+
+	// Only the default link target
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, targetFile)), 0644)
+
+	out, err := runAgentsS(t, tempDir, "use", "coder")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	// The link resolves the inheritance and hides the frontmatter
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Target not written: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(string(content), "Be careful.") || !strings.Contains(string(content), "Coder.") {
+		t.Errorf("Expected the merged persona through the link, got %q", content)
+	}
+	if strings.Contains(string(content), "extends:") || strings.HasPrefix(string(content), "---") {
+		t.Errorf("Expected no frontmatter through the link, got %q", content)
+	}
+	if dest, _ := os.Readlink(targetFile); dest == filepath.Join(agentsDir, "AGENTS.coder.md") {
+		t.Errorf("Expected the link to point at a rendered copy, got %s", dest)
+	}
+	if !strings.Contains(out, "Updated (rendered link): "+targetFile+" -> ") {
+		t.Errorf("Expected use to report the rendered link, got:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "status")
+	if err != nil || !strings.Contains(out, "OK") {
+		t.Errorf("Expected the rendered link to be OK: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "Rendered copy at ") {
+		t.Errorf("Expected status to name the rendered copy, got:\n%s", out)
+	}
+	out, err = runAgentsS(t, tempDir, "diff")
+	if err != nil {
+		t.Errorf("Expected no differences for the rendered link: %v\nOutput: %s", err, out)
+	}
+
+	// A persona without frontmatter is still linked directly
+	out, err = runAgentsS(t, tempDir, "use", "plain")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); dest != filepath.Join(agentsDir, "AGENTS.plain.md") {
+		t.Errorf("Expected a direct link to the plain persona, got %s", dest)
+	}
+
+	// Metadata alone is enough to link through a rendered copy
+	out, err = runAgentsS(t, tempDir, "use", "described")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "# Role\nDescribed.\n" {
+		t.Errorf("Expected the frontmatter to be hidden from the link, got %q", content)
+	}
+}
+
+func TestRenderedCopiesCleanup(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-rendered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.reviewer.md"), []byte("Review.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    render: true
+`, agentsDir, targetFile, targetFile)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	coderCopy, err := os.Readlink(targetFile)
+	if err != nil {
+		t.Fatalf("Expected a rendered link: %v", err)
+	}
+	// Rendered copies are kept with the state, not in a cache that may be cleared
+	if !strings.HasPrefix(coderCopy, filepath.Join(tempDir, ".local", "state", "agent-smith", "rendered")) {
+		t.Errorf("Expected the rendered copy under the state directory, got %s", coderCopy)
+	}
+	renderedDir := filepath.Dir(coderCopy)
+
+	// Pop deletes the copy rendered for the pushed persona
+	if out, err := runAgentsS(t, tempDir, "push", "reviewer"); err != nil {
+		t.Fatalf("push failed: %v\nOutput: %s", err, out)
+	}
+	reviewerCopy, _ := os.Readlink(targetFile)
+	if out, err := runAgentsS(t, tempDir, "pop"); err != nil {
+		t.Fatalf("pop failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Lstat(reviewerCopy); !os.IsNotExist(err) {
+		t.Errorf("Expected pop to delete %s", reviewerCopy)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "Code.\n" {
+		t.Errorf("Expected the coder link to still resolve, got %q", content)
+	}
+
+	// Unuse deletes the rendered copies with the target, undo puts them back
+	if out, err := runAgentsS(t, tempDir, "unuse"); err != nil {
+		t.Fatalf("unuse failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Lstat(renderedDir); !os.IsNotExist(err) {
+		t.Errorf("Expected unuse to delete %s", renderedDir)
+	}
+	if out, err := runAgentsS(t, tempDir, "undo"); err != nil {
+		t.Fatalf("undo failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "Code.\n" {
+		t.Errorf("Expected undo to restore a working link, got %q", content)
+	}
+
+	// Drop deletes them too
+	if out, err := runAgentsS(t, tempDir, "drop", "coder"); err != nil {
+		t.Fatalf("drop failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Lstat(renderedDir); !os.IsNotExist(err) {
+		t.Errorf("Expected drop to delete %s", renderedDir)
+	}
+}
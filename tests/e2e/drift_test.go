@@ -0,0 +1,220 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopyDriftDetection(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-drift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+
+	source := filepath.Join(agentsDir, "AGENTS.coder.md")
+	os.WriteFile(source, []byte("Code."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	expectStatus := func(want string) {
+		t.Helper()
+		out, err := runAgentsS(t, tempDir, "status")
+		if err != nil {
+			t.Fatalf("status failed: %v\nOutput: %s", err, out)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if strings.Contains(line, "COPY.md") {
+				if !strings.Contains(line, "["+want+"]") {
+					t.Errorf("Expected copy target [%s], got: %s", want, line)
+				}
+				return
+			}
+		}
+		t.Errorf("Copy target missing from status:\n%s", out)
+	}
+
+	expectStatus("OK")
+
+	// Local edit
+	os.WriteFile(copyTarget, []byte("Edited."), 0644)
+	expectStatus("MODIFIED")
+
+	// Both changed
+	os.WriteFile(source, []byte("Code better."), 0644)
+	expectStatus("CONFLICT")
+
+	// Only the source changed
+	os.WriteFile(copyTarget, []byte("Code."), 0644)
+	expectStatus("STALE")
+
+	// Reconcile refreshes the copy and records the new hashes
+	if out, err := runAgentsS(t, tempDir, "reconcile"); err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(copyTarget); string(content) != "Code better." {
+		t.Errorf("Expected refreshed copy, got %q", content)
+	}
+	expectStatus("OK")
+}
+
+func TestReconcileStaleOnly(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+
+	source := filepath.Join(agentsDir, "AGENTS.coder.md")
+	os.WriteFile(source, []byte("Code."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	staleCopy := filepath.Join(tempDir, "STALE.md")
+	editedCopy := filepath.Join(tempDir, "EDITED.md")
+	extraLink := filepath.Join(tempDir, "LINK.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+  - path: "%s"
+    mode: "copy"
+  - path: "%s"
+    mode: "link"
+`, agentsDir, targetFile, staleCopy, editedCopy, extraLink)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	statusFile := filepath.Join(configDir, "status.yaml")
+	if data, _ := os.ReadFile(statusFile); !strings.Contains(string(data), "source_mtime:") {
+		t.Errorf("Expected the source modification time in the state, got:\n%s", data)
+	}
+
+	out, _ := runAgentsS(t, tempDir, "reconcile", "--stale-only")
+	if !strings.Contains(out, "No stale targets") {
+		t.Errorf("Expected nothing to refresh, got:\n%s", out)
+	}
+
+	os.WriteFile(source, []byte("Code better."), 0644)
+	os.WriteFile(editedCopy, []byte("Edited."), 0644)
+	os.Remove(extraLink)
+
+	out, _ = runAgentsS(t, tempDir, "status")
+	if !strings.Contains(out, "STALE.md") || !strings.Contains(out, "[STALE]") || !strings.Contains(out, ", edited ") {
+		t.Errorf("Expected the copy to be stale with the edit time, got:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "reconcile", "--stale-only")
+	if err != nil {
+		t.Fatalf("reconcile --stale-only failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(staleCopy); string(content) != "Code better." {
+		t.Errorf("Expected the stale copy to be refreshed, got %q", content)
+	}
+	if content, _ := os.ReadFile(editedCopy); string(content) != "Edited." {
+		t.Errorf("Expected the edited copy to be left alone, got %q", content)
+	}
+	if _, err := os.Lstat(extraLink); !os.IsNotExist(err) {
+		t.Errorf("Expected the missing link to be left alone")
+	}
+
+	out, _ = runAgentsS(t, tempDir, "status")
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.Contains(line, "STALE.md") && !strings.Contains(line, "[OK]"):
+			t.Errorf("Expected the refreshed copy to be OK, got: %s", line)
+		case strings.Contains(line, "EDITED.md") && !strings.Contains(line, "[CONFLICT]"):
+			t.Errorf("Expected the edited copy to still be in conflict, got: %s", line)
+		case strings.Contains(line, "LINK.md") && !strings.Contains(line, "[MISSING]"):
+			t.Errorf("Expected the link to still be missing, got: %s", line)
+		}
+	}
+}
+
+func TestReconcileWithoutChangesWritesNothing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-noop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	renderedTarget := filepath.Join(tempDir, "RENDERED.md")
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+  - path: "%s"
+    mode: copy
+  - path: "%s"
+    render: true
+`, agentsDir, targetFile, targetFile, copyTarget, renderedTarget)), 0644)
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	cache, err := os.Readlink(renderedTarget)
+	if err != nil {
+		t.Fatalf("Expected a rendered link: %v", err)
+	}
+
+	paths := []string{targetFile, copyTarget, renderedTarget, cache}
+	before := make(map[string]os.FileInfo)
+	for _, p := range paths {
+		info, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[p] = info
+	}
+
+	if out, err := runAgentsS(t, tempDir, "reconcile"); err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	for _, p := range paths {
+		info, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(before[p], info) || !before[p].ModTime().Equal(info.ModTime()) {
+			t.Errorf("Expected %s to be left as it was", p)
+		}
+	}
+}
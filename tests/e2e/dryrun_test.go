@@ -0,0 +1,79 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDryRunChangesNothing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-dryrun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "nested", "COPY.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	out, err := runAgentsS(t, tempDir, "use", "coder", "--dry-run")
+	if err != nil {
+		t.Fatalf("use --dry-run failed: %v\nOutput: %s", err, out)
+	}
+	for _, want := range []string{"mkdir", "create-copy", "create-link"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected plan to contain %q, got:\n%s", want, out)
+		}
+	}
+	if _, err := os.Lstat(targetFile); !os.IsNotExist(err) {
+		t.Error("Dry run created the canonical target")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "nested")); !os.IsNotExist(err) {
+		t.Error("Dry run created the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(configDir, "status.yaml")); !os.IsNotExist(err) {
+		t.Error("Dry run wrote the state file")
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "unuse", "--dry-run")
+	if err != nil {
+		t.Fatalf("unuse --dry-run failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "remove") || !strings.Contains(out, copyTarget) {
+		t.Errorf("Expected removal plan, got:\n%s", out)
+	}
+	if _, err := os.Lstat(targetFile); err != nil {
+		t.Error("Dry run removed the canonical target")
+	}
+	if _, err := os.Lstat(copyTarget); err != nil {
+		t.Error("Dry run removed the copy target")
+	}
+
+	out, err = runAgentsS(t, tempDir, "reconcile", "--dry-run")
+	if err != nil {
+		t.Fatalf("reconcile --dry-run failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "unchanged") {
+		t.Errorf("Expected unchanged targets in plan, got:\n%s", out)
+	}
+}
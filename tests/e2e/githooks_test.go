@@ -0,0 +1,115 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitHooks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tempDir, err := os.MkdirTemp("", "agents-e2e-githooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+branches:
+  - pattern: "docs/*"
+    persona: writer
+  - pattern: "main"
+    persona: coder
+`, agentsDir, targetFile)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	repo := filepath.Join(tempDir, "repo")
+	os.MkdirAll(repo, 0755)
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(),
+			"HOME="+tempDir,
+			"XDG_CONFIG_HOME="+filepath.Join(tempDir, ".config"),
+			"XDG_DATA_HOME="+filepath.Join(tempDir, ".local", "share"),
+			"XDG_STATE_HOME="+filepath.Join(tempDir, ".local", "state"),
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\nOutput: %s", args, err, out)
+		}
+		return string(out)
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "init")
+
+	// An existing hook must keep running
+	hooksDir := filepath.Join(repo, ".git", "hooks")
+	os.MkdirAll(hooksDir, 0755)
+	existing := "#!/bin/sh\necho ran >> \"$(git rev-parse --git-dir)/existing-hook.log\"\n"
+	os.WriteFile(filepath.Join(hooksDir, "post-checkout"), []byte(existing), 0755)
+
+	out, err := runAgentsIn(t, tempDir, repo, "git", "install-hooks")
+	if err != nil {
+		t.Fatalf("install-hooks failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "post-checkout.pre-agents") {
+		t.Errorf("Expected the existing hook to be chained, got:\n%s", out)
+	}
+
+	// The switch is reported in a single line between git's own output
+	if out := git("checkout", "-q", "-b", "docs/intro"); out != "agents: branch docs/intro -> writer\n" {
+		t.Errorf("Expected a one-line switch notice, got:\n%s", out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected checkout of docs/intro to switch to writer, got %q", dest)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, ".git", "existing-hook.log")); string(data) != "ran\n" {
+		t.Errorf("Expected the existing hook to run once, log: %q", data)
+	}
+
+	git("checkout", "-q", "main")
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected checkout of main to switch to coder, got %q", dest)
+	}
+
+	// Installing again replaces our hooks without chaining them to themselves
+	if out, err := runAgentsIn(t, tempDir, repo, "git", "install-hooks"); err != nil || strings.Contains(out, "kept as") {
+		t.Fatalf("reinstall failed or chained again: %v\nOutput: %s", err, out)
+	}
+
+	out, err = runAgentsIn(t, tempDir, repo, "git", "uninstall-hooks")
+	if err != nil {
+		t.Fatalf("uninstall-hooks failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(filepath.Join(hooksDir, "post-checkout")); string(data) != existing {
+		t.Errorf("Expected the original post-checkout hook to be restored, got:\n%s", data)
+	}
+	if _, err := os.Lstat(filepath.Join(hooksDir, "post-merge")); !os.IsNotExist(err) {
+		t.Errorf("Expected post-merge hook to be removed")
+	}
+
+	git("checkout", "-q", "docs/intro")
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Persona must not change after uninstall-hooks, got %q", dest)
+	}
+}
@@ -0,0 +1,87 @@
+package e2e_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryAndUsePrevious(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, targetFile)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	if out, err := runAgentsS(t, tempDir, "use", "-"); err == nil {
+		t.Fatalf("Expected use - to fail without history, got:\n%s", out)
+	}
+
+	for _, p := range []string{"coder", "writer"} {
+		if out, err := runAgentsS(t, tempDir, "use", p); err != nil {
+			t.Fatalf("use %s failed: %v\nOutput: %s", p, err, out)
+		}
+	}
+
+	out, err := runAgentsS(t, tempDir, "use", "-")
+	if err != nil {
+		t.Fatalf("use - failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected use - to switch back to coder, got %q", dest)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "-"); err != nil {
+		t.Fatalf("use - failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected a second use - to flip to writer, got %q", dest)
+	}
+
+	out, err = runAgentsS(t, tempDir, "log", "-n", "2")
+	if err != nil {
+		t.Fatalf("log failed: %v\nOutput: %s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "writer") || !strings.Contains(lines[0], "agents use -") {
+		t.Errorf("Expected the two most recent switches, newest first, got:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "log", "--output", "json")
+	if err != nil {
+		t.Fatalf("log --output json failed: %v\nOutput: %s", err, out)
+	}
+	var report struct {
+		Entries []struct {
+			Persona string   `json:"persona"`
+			Targets []string `json:"targets"`
+			Command string   `json:"command"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, out)
+	}
+	if len(report.Entries) != 4 || report.Entries[3].Persona != "coder" || report.Entries[3].Command != "agents use coder" {
+		t.Errorf("Unexpected log: %+v", report.Entries)
+	}
+	if len(report.Entries[0].Targets) == 0 || report.Entries[0].Targets[0] != targetFile {
+		t.Errorf("Expected targets in log entry, got %+v", report.Entries[0].Targets)
+	}
+}
@@ -0,0 +1,136 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellHook(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, filepath.Join(tempDir, "AGENTS.md"))
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		out, err := runAgentsS(t, tempDir, "hook", shell)
+		if err != nil {
+			t.Fatalf("hook %s failed: %v\nOutput: %s", shell, err, out)
+		}
+		if !strings.Contains(out, "_hook") {
+			t.Errorf("hook %s does not call into agents:\n%s", shell, out)
+		}
+	}
+	if _, err := runAgentsS(t, tempDir, "hook", "tcsh"); err == nil {
+		t.Error("Expected unsupported shell to fail")
+	}
+
+	project := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".agents-persona"), []byte("coder\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Outside a project the hook does nothing
+	if out, err := runAgentsIn(t, tempDir, tempDir, "_hook"); err != nil || out != "" {
+		t.Errorf("Expected silent no-op outside a project, got %v:\n%s", err, out)
+	}
+
+	// A project that was not allowed only gets a notice
+	out, err := runAgentsIn(t, tempDir, project, "_hook")
+	if err != nil || !strings.Contains(out, "run 'agents allow'") {
+		t.Errorf("Expected a notice in a project that was not allowed, got %v:\n%s", err, out)
+	}
+	if _, err := os.Lstat(filepath.Join(project, "AGENTS.md")); !os.IsNotExist(err) {
+		t.Fatal("The hook synced a project that was not allowed")
+	}
+
+	if out, err := runAgentsIn(t, tempDir, project, "allow"); err != nil {
+		t.Fatalf("allow failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runAgentsIn(t, tempDir, project, "_hook")
+	if err != nil {
+		t.Fatalf("_hook failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "-> coder") {
+		t.Errorf("Expected switch message, got:\n%s", out)
+	}
+	if dest, _ := os.Readlink(filepath.Join(project, "AGENTS.md")); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected project target synced, got %q", dest)
+	}
+
+	// Unchanged pin: nothing to do
+	out, err = runAgentsIn(t, tempDir, project, "_hook")
+	if err != nil || strings.Contains(out, "-> coder") {
+		t.Errorf("Expected cached no-op, got %v:\n%s", err, out)
+	}
+
+	// A synced target that went away is put back despite the cache
+	if err := os.Remove(filepath.Join(project, "AGENTS.md")); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runAgentsIn(t, tempDir, project, "_hook")
+	if err != nil || !strings.Contains(out, "-> coder") {
+		t.Errorf("Expected the hook to sync again, got %v:\n%s", err, out)
+	}
+	if dest, _ := os.Readlink(filepath.Join(project, "AGENTS.md")); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected project target restored, got %q", dest)
+	}
+
+	// Switching personas in the project makes the hook check the pin again
+	hookCache := filepath.Join(tempDir, ".cache", "agent-smith", "hook.yaml")
+	if data, _ := os.ReadFile(hookCache); !strings.Contains(string(data), project) {
+		t.Fatalf("Expected the project in the hook cache, got:\n%s", data)
+	}
+	if out, err := runAgentsIn(t, tempDir, project, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(hookCache); strings.Contains(string(data), project) {
+		t.Errorf("Expected use to clear the project from the hook cache, got:\n%s", data)
+	}
+
+	// Changing the pin withdraws the permission until the project is allowed again
+	if err := os.WriteFile(filepath.Join(project, ".agents-persona"), []byte("writer\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runAgentsIn(t, tempDir, project, "_hook")
+	if err != nil || !strings.Contains(out, "changed since it was allowed") || strings.Contains(out, "-> writer") {
+		t.Errorf("Expected the changed project not to be synced, got %v:\n%s", err, out)
+	}
+
+	if out, err := runAgentsIn(t, tempDir, project, "allow"); err != nil {
+		t.Fatalf("allow failed: %v\nOutput: %s", err, out)
+	}
+	if out, err := runAgentsIn(t, tempDir, project, "deny"); err != nil {
+		t.Fatalf("deny failed: %v\nOutput: %s", err, out)
+	}
+	out, err = runAgentsIn(t, tempDir, project, "_hook")
+	if err != nil || !strings.Contains(out, "run 'agents allow'") {
+		t.Errorf("Expected a notice after deny, got %v:\n%s", err, out)
+	}
+}
@@ -0,0 +1,117 @@
+package e2e_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStructuredOutput(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("---\ntags: [go]\n---\nCode."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	// list
+	out, err := runAgentsS(t, tempDir, "list", "--output", "json")
+	if err != nil {
+		t.Fatalf("list failed: %v\nOutput: %s", err, out)
+	}
+	var list struct {
+		Personas []struct {
+			Name string   `json:"name"`
+			Dir  string   `json:"dir"`
+			Tags []string `json:"tags"`
+		} `json:"personas"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("list output is not JSON: %v\n%s", err, out)
+	}
+	if len(list.Personas) != 1 || list.Personas[0].Name != "coder" || list.Personas[0].Dir != agentsDir {
+		t.Errorf("Unexpected list output: %+v", list)
+	}
+
+	// use
+	out, err = runAgentsS(t, tempDir, "use", "coder", "-o", "json")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	var apply struct {
+		Persona string `json:"persona"`
+		Targets []struct {
+			Path   string `json:"path"`
+			Status string `json:"status"`
+		} `json:"targets"`
+	}
+	if err := json.Unmarshal([]byte(out), &apply); err != nil {
+		t.Fatalf("use output is not JSON: %v\n%s", err, out)
+	}
+	if apply.Persona != "coder" || len(apply.Targets) != 2 {
+		t.Errorf("Unexpected use output: %+v", apply)
+	}
+
+	// status
+	out, err = runAgentsS(t, tempDir, "status", "-o", "json")
+	if err != nil {
+		t.Fatalf("status failed: %v\nOutput: %s", err, out)
+	}
+	var status struct {
+		ActivePersona string `json:"active_persona"`
+		Personas      []struct {
+			Name    string `json:"name"`
+			Active  bool   `json:"active"`
+			Targets []struct {
+				Status string `json:"status"`
+			} `json:"targets"`
+		} `json:"personas"`
+	}
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		t.Fatalf("status output is not JSON: %v\n%s", err, out)
+	}
+	if status.ActivePersona != "coder" || len(status.Personas) != 1 || !status.Personas[0].Active {
+		t.Errorf("Unexpected status output: %+v", status)
+	}
+	for _, target := range status.Personas[0].Targets {
+		if target.Status != "OK" {
+			t.Errorf("Expected OK target status, got %s", target.Status)
+		}
+	}
+
+	// Failure is reported as JSON with a non-zero exit code
+	out, err = runAgentsS(t, tempDir, "use", "missing", "-o", "json")
+	if err == nil {
+		t.Fatalf("Expected use of missing persona to fail:\n%s", out)
+	}
+	var failure struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(out), &failure); err != nil || failure.Error == "" {
+		t.Errorf("Expected JSON error report, got:\n%s", out)
+	}
+
+	// Invalid format
+	if out, err := runAgentsS(t, tempDir, "status", "-o", "xml"); err == nil {
+		t.Errorf("Expected invalid output format to fail:\n%s", out)
+	}
+}
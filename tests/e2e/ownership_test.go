@@ -0,0 +1,84 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnuseKeepsForeignFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-ownership")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code.\n"), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	linkTarget := filepath.Join(tempDir, "LINK.md")
+	markedCopy := filepath.Join(tempDir, "MARKED.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "link"
+  - path: "%s"
+    mode: "copy"
+    marker: true
+`, agentsDir, targetFile, linkTarget, markedCopy)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	content, _ := os.ReadFile(markedCopy)
+	if !strings.HasPrefix(string(content), "<!-- Managed by agent-smith") || !strings.HasSuffix(string(content), "Code.\n") {
+		t.Errorf("Expected marked copy, got %q", content)
+	}
+
+	// The user replaces the link with their own file and edits the marked copy
+	os.Remove(linkTarget)
+	os.WriteFile(linkTarget, []byte("Mine."), 0644)
+	os.WriteFile(markedCopy, append(content, []byte("More.\n")...), 0644)
+
+	out, err := runAgentsS(t, tempDir, "unuse")
+	if err != nil {
+		t.Fatalf("unuse failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "Refusing to remove "+linkTarget) {
+		t.Errorf("Expected unuse to refuse the foreign file, got:\n%s", out)
+	}
+	if c, _ := os.ReadFile(linkTarget); string(c) != "Mine." {
+		t.Errorf("Foreign file was changed: %q", c)
+	}
+	if _, err := os.Lstat(markedCopy); !os.IsNotExist(err) {
+		t.Error("Expected edited copy with marker to be removed")
+	}
+	if _, err := os.Lstat(targetFile); !os.IsNotExist(err) {
+		t.Error("Expected canonical link to be removed")
+	}
+	// Only the removed targets stop being tracked
+	st, _ := os.ReadFile(filepath.Join(configDir, "status.yaml"))
+	if !strings.Contains(string(st), linkTarget) || strings.Contains(string(st), markedCopy) {
+		t.Errorf("Expected only the skipped target to stay tracked, got:\n%s", st)
+	}
+
+	out, err = runAgentsS(t, tempDir, "unuse", "--force")
+	if err != nil {
+		t.Fatalf("unuse --force failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Lstat(linkTarget); !os.IsNotExist(err) {
+		t.Error("Expected --force to remove the foreign file")
+	}
+	if st, _ := os.ReadFile(filepath.Join(configDir, "status.yaml")); strings.Contains(string(st), linkTarget) {
+		t.Errorf("Expected the forced target to stop being tracked, got:\n%s", st)
+	}
+}
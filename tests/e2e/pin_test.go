@@ -0,0 +1,325 @@
+package e2e_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPinAndSync(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, targetFile)
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user works with writer globally
+	if out, err := runAgentsS(t, tempDir, "use", "writer"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	project := filepath.Join(tempDir, "backend")
+	if err := os.MkdirAll(filepath.Join(project, "cmd"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".agents-persona"), []byte("# pinned for this repo\ncoder\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	projectTarget := filepath.Join(project, "AGENTS.md")
+
+	out, _ := runAgentsIn(t, tempDir, project, "status")
+	if !strings.Contains(out, "Project pin: coder") || !strings.Contains(out, "OUT OF SYNC") {
+		t.Errorf("Expected unsynced pin in status, got:\n%s", out)
+	}
+
+	out, err = runAgentsIn(t, tempDir, filepath.Join(project, "cmd"), "sync")
+	if err != nil {
+		t.Fatalf("sync failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(projectTarget); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected project target linked to coder, got %q", dest)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("sync must not change the canonical target, got %q", dest)
+	}
+
+	out, _ = runAgentsIn(t, tempDir, project, "status")
+	if !strings.Contains(out, "[IN SYNC]") {
+		t.Errorf("Expected pin in sync, got:\n%s", out)
+	}
+
+	// Re-pinning puts the project out of sync until the next sync
+	if err := os.WriteFile(filepath.Join(project, ".agents-persona"), []byte("writer\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, _ = runAgentsIn(t, tempDir, project, "status")
+	if !strings.Contains(out, "OUT OF SYNC") {
+		t.Errorf("Expected pin out of sync after re-pinning, got:\n%s", out)
+	}
+	if out, err := runAgentsIn(t, tempDir, project, "sync"); err != nil {
+		t.Fatalf("sync failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(projectTarget); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected project target linked to writer, got %q", dest)
+	}
+	out, _ = runAgentsIn(t, tempDir, project, "status")
+	if !strings.Contains(out, "[IN SYNC]") {
+		t.Errorf("Expected pin in sync, got:\n%s", out)
+	}
+}
+
+func TestSyncNestedProjects(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-pin-nested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, filepath.Join(tempDir, "AGENTS.md"))), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pin in a service of a monorepo whose .agents.yaml lists targets of its own
+	monorepo := filepath.Join(tempDir, "monorepo")
+	service := filepath.Join(monorepo, "service")
+	if err := os.MkdirAll(service, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(monorepo, ".agents.yaml"), []byte("targets:\n  - path: ./ROOT.md\n    mode: copy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(service, ".agents-persona"), []byte("coder\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsIn(t, tempDir, service, "sync"); err != nil {
+		t.Fatalf("sync failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(filepath.Join(service, "AGENTS.md")); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected the service's default target linked to coder, got %q", dest)
+	}
+	if _, err := os.Lstat(filepath.Join(monorepo, "ROOT.md")); !os.IsNotExist(err) {
+		t.Error("sync must not write the targets of the parent's .agents.yaml")
+	}
+
+	// A pin in a parent project synced from a nested directory with its own .agents.yaml
+	outer := filepath.Join(tempDir, "outer")
+	inner := filepath.Join(outer, "inner")
+	if err := os.MkdirAll(inner, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outer, ".agents.yaml"), []byte("persona: coder\ntargets:\n  - path: ./OUTER.md\n    mode: copy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inner, ".agents.yaml"), []byte("targets:\n  - path: ./INNER.md\n    mode: copy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsIn(t, tempDir, inner, "sync"); err != nil {
+		t.Fatalf("sync failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(filepath.Join(outer, "OUTER.md")); string(content) != "Code." {
+		t.Errorf("Expected the pinned project's target written, got %q", content)
+	}
+	if _, err := os.Lstat(filepath.Join(inner, "INNER.md")); !os.IsNotExist(err) {
+		t.Error("sync must not write the targets of the nested .agents.yaml")
+	}
+}
+
+func TestSyncKeepsTrackingAfterUse(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-pin-use")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, filepath.Join(tempDir, "AGENTS.md"))), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	project := filepath.Join(tempDir, "backend")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".agents.yaml"), []byte("persona: coder\ntargets:\n  - path: ./CLAUDE.md\n    mode: copy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	projectTarget := filepath.Join(project, "CLAUDE.md")
+
+	// Using the pinned persona again elsewhere must not make sync forget its own target,
+	// or the next sync no longer recognizes the copy once the persona changed
+	for i := 1; i <= 2; i++ {
+		if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte(fmt.Sprintf("Code v%d.", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+			t.Fatalf("use failed: %v\nOutput: %s", err, out)
+		}
+		out, err := runAgentsIn(t, tempDir, project, "sync")
+		if err != nil {
+			t.Fatalf("sync failed: %v\nOutput: %s", err, out)
+		}
+		if strings.Contains(out, "Backed up") {
+			t.Errorf("sync %d backed up its own target:\n%s", i, out)
+		}
+	}
+	if content, _ := os.ReadFile(projectTarget); string(content) != "Code v2." {
+		t.Errorf("Expected project target copied from coder, got %q", content)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(tempDir, ".local", "state", "agent-smith", "backups")); len(entries) > 0 {
+		t.Errorf("Expected no backups, got %d", len(entries))
+	}
+	out, _ := runAgentsIn(t, tempDir, project, "status")
+	if !strings.Contains(out, "[IN SYNC]") {
+		t.Errorf("Expected pin in sync, got:\n%s", out)
+	}
+}
+
+func TestShadowedPersonaEntries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-pin-shadow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("User coder."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: copy
+`, agentsDir, filepath.Join(tempDir, "AGENTS.md"), copyTarget)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A project whose own coder shadows the user's
+	project := filepath.Join(tempDir, "backend")
+	if err := os.MkdirAll(filepath.Join(project, "personas"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "personas", "AGENTS.coder.md"), []byte("Project coder."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".agents.yaml"), []byte("persona: coder\nagents_dir: [./personas]\ntargets:\n  - path: ./CLAUDE.md\n    mode: copy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if out, err := runAgentsIn(t, tempDir, project, "sync"); err != nil {
+		t.Fatalf("sync failed: %v\nOutput: %s", err, out)
+	}
+
+	// Each entry is checked against its own persona file, and only the one that wrote the canonical target is active
+	out, err := runAgentsIn(t, tempDir, project, "status", "--output", "json")
+	if err != nil {
+		t.Fatalf("status failed: %v\nOutput: %s", err, out)
+	}
+	var report struct {
+		Personas []struct {
+			Name    string `json:"name"`
+			Path    string `json:"path"`
+			Active  bool   `json:"active"`
+			Targets []struct {
+				Path   string `json:"path"`
+				Status string `json:"status"`
+			} `json:"targets"`
+		} `json:"personas"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Invalid status JSON: %v\nOutput: %s", err, out)
+	}
+	active := 0
+	for _, p := range report.Personas {
+		if p.Active {
+			active++
+			if p.Path != filepath.Join(agentsDir, "AGENTS.coder.md") {
+				t.Errorf("Expected the user's coder to be active, got %s", p.Path)
+			}
+		}
+		for _, tr := range p.Targets {
+			if tr.Status != "OK" {
+				t.Errorf("Expected %s of %s to be OK, got %s", tr.Path, p.Path, tr.Status)
+			}
+		}
+	}
+	if active != 1 {
+		t.Errorf("Expected one active entry, got %d:\n%s", active, out)
+	}
+
+	// diff and reconcile use the persona file of the active entry, not the one shadowing it
+	if out, err := runAgentsIn(t, tempDir, project, "diff"); err != nil {
+		t.Errorf("Expected no differences: %v\nOutput: %s", err, out)
+	}
+	if out, err := runAgentsIn(t, tempDir, project, "reconcile"); err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(copyTarget); string(content) != "User coder." {
+		t.Errorf("Expected reconcile to keep the user's coder, got %q", content)
+	}
+}
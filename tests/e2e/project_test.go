@@ -0,0 +1,119 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runAgentsIn runs the agents binary from dir with an isolated home
+func runAgentsIn(t *testing.T, homeDir, dir string, args ...string) (string, error) {
+	cmd := exec.Command(testBinaryPath, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HOME="+homeDir)
+	cmd.Env = append(cmd.Env, "XDG_CONFIG_HOME="+filepath.Join(homeDir, ".config"))
+	cmd.Env = append(cmd.Env, "XDG_DATA_HOME="+filepath.Join(homeDir, ".local", "share"))
+	cmd.Env = append(cmd.Env, "XDG_STATE_HOME="+filepath.Join(homeDir, ".local", "state"))
+
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestProjectConfig(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("User coder."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+vars:
+  team: user
+`, agentsDir, targetFile)
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A project with its own persona, a copy target and a default persona
+	project := filepath.Join(tempDir, "repo")
+	personas := filepath.Join(project, ".agents", "personas")
+	if err := os.MkdirAll(filepath.Join(project, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(personas, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(personas, "AGENTS.coder.md"), []byte("---\ntemplate: true\n---\nProject coder for {{ .Vars.team }}."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, ".agents.yaml"), []byte(`
+persona: coder
+agents_dir: ["./.agents/personas"]
+targets:
+  - path: "./CLAUDE.md"
+    mode: "copy"
+vars:
+  team: project
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runAgentsIn(t, tempDir, filepath.Join(project, "src"), "use")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	// The project persona shadows the user one and project vars win
+	content, err := os.ReadFile(filepath.Join(project, "CLAUDE.md"))
+	if err != nil {
+		t.Fatalf("Project target not written: %v\nOutput: %s", err, out)
+	}
+	if string(content) != "Project coder for project." {
+		t.Errorf("Unexpected project target content %q", content)
+	}
+	// The persona is a template, so the canonical target links to its rendered copy
+	if linked, _ := os.ReadFile(targetFile); string(linked) != "Project coder for project." {
+		t.Errorf("Expected canonical link to the rendered project persona, got %q", linked)
+	}
+
+	out, _ = runAgentsIn(t, tempDir, project, "status")
+	if !strings.Contains(out, "Project config: "+filepath.Join(project, ".agents.yaml")) {
+		t.Errorf("Expected status to show the project config, got:\n%s", out)
+	}
+
+	// --no-project falls back to the user config
+	out, err = runAgentsIn(t, tempDir, project, "--no-project", "use")
+	if err == nil {
+		t.Errorf("Expected use without persona to fail with --no-project\nOutput: %s", out)
+	}
+
+	// A project may not write outside its directory
+	if err := os.WriteFile(filepath.Join(project, ".agents.yaml"), []byte("targets:\n  - path: \"~/.bashrc\"\n    mode: copy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runAgentsIn(t, tempDir, project, "use", "coder")
+	if err == nil || !strings.Contains(out, "inside the project") {
+		t.Errorf("Expected a project target in the home directory to be refused, got %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, ".bashrc")); !os.IsNotExist(err) {
+		t.Error("Project config wrote outside the project")
+	}
+}
@@ -0,0 +1,104 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestService(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configFile := filepath.Join(configDir, "config.yaml")
+	os.WriteFile(configFile, []byte(fmt.Sprintf("agents_dir: [\"%s\"]\ntarget_file: \"%s\"\n", agentsDir, targetFile)), 0644)
+
+	unitDir := filepath.Join(tempDir, ".config", "systemd", "user")
+
+	// --print writes nothing
+	out, err := runAgentsS(t, tempDir, "service", "install", "--platform", "systemd", "--mode", "path", "--print")
+	if err != nil {
+		t.Fatalf("install --print failed: %v\nOutput: %s", err, out)
+	}
+	for _, want := range []string{
+		"# " + filepath.Join(unitDir, "agent-smith.service"),
+		"ExecStart=" + testBinaryPath + " --config " + configFile + " reconcile",
+		"PathChanged=" + agentsDir,
+		"Environment=XDG_STATE_HOME=" + filepath.Join(tempDir, ".local", "state"),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in printed units, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "PathChanged="+tempDir+"\n") {
+		t.Errorf("The directory of the canonical target must not be watched, got:\n%s", out)
+	}
+	if _, err := os.Stat(unitDir); !os.IsNotExist(err) {
+		t.Errorf("--print should not write anything")
+	}
+
+	out, err = runAgentsS(t, tempDir, "service", "install", "--platform", "launchd", "--mode", "timer", "--print")
+	if err != nil {
+		t.Fatalf("install --print failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, filepath.Join(tempDir, "Library", "LaunchAgents", "agent-smith.plist")) || !strings.Contains(out, "<integer>900</integer>") {
+		t.Errorf("Expected a launch agent reconciling every 15m, got:\n%s", out)
+	}
+
+	// Install the timer, then switch to watch: the timer unit goes away
+	out, err = runAgentsS(t, tempDir, "service", "install", "--platform", "systemd", "--mode", "timer", "--interval", "1h", "--files-only")
+	if err != nil {
+		t.Fatalf("install failed: %v\nOutput: %s", err, out)
+	}
+	timer := filepath.Join(unitDir, "agent-smith.timer")
+	if data, err := os.ReadFile(timer); err != nil || !strings.Contains(string(data), "OnUnitActiveSec=3600s") {
+		t.Fatalf("Expected an hourly timer, got %q (%v)", data, err)
+	}
+
+	out, err = runAgentsS(t, tempDir, "service", "status", "--platform", "systemd")
+	if err != nil || !strings.Contains(out, "agent-smith.timer") || !strings.Contains(out, "mode timer") || !strings.Contains(out, "[INSTALLED]") {
+		t.Errorf("Expected the timer in status, got:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "service", "install", "--platform", "systemd", "--files-only")
+	if err != nil {
+		t.Fatalf("install failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Stat(timer); !os.IsNotExist(err) {
+		t.Errorf("Expected the timer to be removed when switching to watch")
+	}
+	if data, _ := os.ReadFile(filepath.Join(unitDir, "agent-smith.service")); !strings.Contains(string(data), " watch\n") {
+		t.Errorf("Expected a watch service, got:\n%s", data)
+	}
+
+	// A unit for another binary is outdated
+	service := filepath.Join(unitDir, "agent-smith.service")
+	data, _ := os.ReadFile(service)
+	os.WriteFile(service, []byte(strings.ReplaceAll(string(data), testBinaryPath, "/old/agents")), 0644)
+	out, _ = runAgentsS(t, tempDir, "service", "status", "--platform", "systemd", "-o", "json")
+	if !strings.Contains(out, `"status": "OUTDATED"`) {
+		t.Errorf("Expected the service to be outdated, got:\n%s", out)
+	}
+
+	out, err = runAgentsS(t, tempDir, "service", "uninstall", "--platform", "systemd", "--files-only")
+	if err != nil {
+		t.Fatalf("uninstall failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Stat(service); !os.IsNotExist(err) {
+		t.Errorf("Expected the service to be removed")
+	}
+	out, _ = runAgentsS(t, tempDir, "service", "status", "--platform", "systemd")
+	if !strings.Contains(out, "No service installed") {
+		t.Errorf("Expected no service after uninstall, got:\n%s", out)
+	}
+}
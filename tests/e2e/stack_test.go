@@ -0,0 +1,236 @@
+package e2e_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPushPop(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-stack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("---\ntemplate: true\n---\nCode for {{ .Vars.team }}."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.reviewer.md"), []byte("Review."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "repo", "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "pop"); err == nil {
+		t.Fatalf("Expected pop to fail on an empty stack, got:\n%s", out)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder", "--set", "team=platform"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	out, err := runAgentsS(t, tempDir, "push", "reviewer")
+	if err != nil {
+		t.Fatalf("push failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(copyTarget); string(data) != "Review." {
+		t.Errorf("Expected reviewer applied, got %q", data)
+	}
+
+	out, err = runAgentsS(t, tempDir, "status", "--output", "json")
+	if err != nil {
+		t.Fatalf("status failed: %v\nOutput: %s", err, out)
+	}
+	var report struct {
+		ActivePersona string `json:"active_persona"`
+		Stack         []struct {
+			Persona string   `json:"persona"`
+			Targets []string `json:"targets"`
+		} `json:"stack"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, out)
+	}
+	if report.ActivePersona != "reviewer" || len(report.Stack) != 1 || report.Stack[0].Persona != "coder" || len(report.Stack[0].Targets) != 2 {
+		t.Errorf("Unexpected status after push: %+v", report)
+	}
+	if out, _ := runAgentsS(t, tempDir, "status"); !strings.Contains(out, "Persona stack") {
+		t.Errorf("Expected the stack in status, got:\n%s", out)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "pop"); err != nil {
+		t.Fatalf("pop failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected pop to restore coder, got %q", dest)
+	}
+	if data, _ := os.ReadFile(copyTarget); string(data) != "Code for platform." {
+		t.Errorf("Expected pop to restore coder with its variables, got %q", data)
+	}
+	if out, _ := runAgentsS(t, tempDir, "status"); strings.Contains(out, "Persona stack") {
+		t.Errorf("Expected an empty stack after pop, got:\n%s", out)
+	}
+	if out, err := runAgentsS(t, tempDir, "reconcile"); err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(copyTarget); string(data) != "Code for platform." {
+		t.Errorf("Expected the variables to be kept for reconcile, got %q", data)
+	}
+}
+
+func TestPopRemovesPushedOnlyTargets(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-stack-targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.reviewer.md"), []byte("Review."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	extraTarget := filepath.Join(tempDir, "EXTRA.md")
+	configFile := filepath.Join(configDir, "config.yaml")
+	writeConfig := func(extra string) {
+		if err := os.WriteFile(configFile, []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+  - path: "%s"
+    mode: copy%s
+`, agentsDir, targetFile, targetFile, copyTarget, extra)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("")
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	// reviewer is pushed with a target coder does not have, over a hand-written file
+	if err := os.WriteFile(extraTarget, []byte("Mine."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeConfig(fmt.Sprintf("\n  - path: \"%s\"\n    mode: copy", extraTarget))
+	if out, err := runAgentsS(t, tempDir, "push", "reviewer"); err != nil {
+		t.Fatalf("push failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(extraTarget); string(data) != "Review." {
+		t.Fatalf("Expected reviewer in the extra target, got %q", data)
+	}
+
+	out, err := runAgentsS(t, tempDir, "pop")
+	if err != nil {
+		t.Fatalf("pop failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(copyTarget); string(data) != "Code." {
+		t.Errorf("Expected pop to restore coder, got %q", data)
+	}
+	if data, _ := os.ReadFile(extraTarget); string(data) != "Mine." {
+		t.Errorf("Expected pop to put back the file the push replaced, got %q", data)
+	}
+	st, _ := os.ReadFile(filepath.Join(configDir, "status.yaml"))
+	if strings.Contains(string(st), "name: reviewer") || strings.Contains(string(st), extraTarget) {
+		t.Errorf("Expected reviewer and its target to be untracked after pop, got:\n%s", st)
+	}
+	if out, _ := runAgentsS(t, tempDir, "restore"); !strings.Contains(out, "No backups.") {
+		t.Errorf("Expected the backup to be consumed, got:\n%s", out)
+	}
+}
+
+func TestPushReportsStackFailureOnce(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-stack-fail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"coder", "reviewer"} {
+		if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS."+p+".md"), []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, targetFile)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	// A state file that cannot be written makes saving the stack fail after the switch
+	statusFile := filepath.Join(configDir, "status.yaml")
+	if err := os.Remove(statusFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(statusFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runAgentsS(t, tempDir, "push", "reviewer", "--output", "json")
+	if err == nil {
+		t.Fatalf("Expected push to fail when the stack cannot be saved\nOutput: %s", out)
+	}
+	if strings.Count(out, `"persona":`) != 1 || strings.Count(out, `"error":`) != 1 {
+		t.Errorf("Expected a single report carrying the error, got:\n%s", out)
+	}
+	var report struct {
+		Persona string `json:"persona"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(out[strings.Index(out, "{"):]), &report); err != nil {
+		t.Fatalf("Expected one JSON document: %v\nOutput: %s", err, out)
+	}
+	if report.Persona != "reviewer" || !strings.Contains(report.Error, "stack") {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+}
@@ -0,0 +1,121 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// expireStack moves every expiry recorded in status.yaml into the past
+func expireStack(t *testing.T, statusFile string) {
+	t.Helper()
+	data, err := os.ReadFile(statusFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re := regexp.MustCompile(`(?m)^(\s*expires:).*$`)
+	if !re.Match(data) {
+		t.Fatalf("No expiry in state:\n%s", data)
+	}
+	os.WriteFile(statusFile, re.ReplaceAll(data, []byte("${1} 2000-01-01T00:00:00Z")), 0644)
+}
+
+func TestUseFor(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-timebox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	for _, p := range []string{"coder", "reviewer", "writer"} {
+		os.WriteFile(filepath.Join(agentsDir, "AGENTS."+p+".md"), []byte(p), 0644)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+`, agentsDir, targetFile)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+	statusFile := filepath.Join(configDir, "status.yaml")
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	out, err := runAgentsS(t, tempDir, "use", "reviewer", "--for", "2h")
+	if err != nil {
+		t.Fatalf("use --for failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.reviewer.md" {
+		t.Fatalf("Expected reviewer active, got %q", dest)
+	}
+	out, _ = runAgentsS(t, tempDir, "status")
+	if !strings.Contains(out, "Persona: reviewer [ACTIVE]") || !strings.Contains(out, "back when 'reviewer' expires") {
+		t.Errorf("Expected the pending expiry in status, got:\n%s", out)
+	}
+
+	// Once expired, any status reverts
+	expireStack(t, statusFile)
+	out, err = runAgentsS(t, tempDir, "status")
+	if err != nil {
+		t.Fatalf("status failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "switched back to 'coder'") || !strings.Contains(out, "Persona: coder [ACTIVE]") {
+		t.Errorf("Expected status to revert to coder, got:\n%s", out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected coder active after expiry, got %q", dest)
+	}
+	if strings.Contains(out, "Persona stack") {
+		t.Errorf("Expected the stack to be empty after the revert, got:\n%s", out)
+	}
+
+	// A persona chosen by hand in the meantime is kept
+	runAgentsS(t, tempDir, "use", "reviewer", "--for", "2h")
+	runAgentsS(t, tempDir, "use", "writer")
+	expireStack(t, statusFile)
+	out, err = runAgentsS(t, tempDir, "reconcile")
+	if err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected writer to stay active, got %q", dest)
+	}
+	if data, _ := os.ReadFile(statusFile); strings.Contains(string(data), "stack:") {
+		t.Errorf("Expected the expired entry to be dropped:\n%s", data)
+	}
+
+	// A revert that fails is a warning: status still reports and the entry is kept for the next try
+	copyTarget := filepath.Join(tempDir, "COPY.md")
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent+fmt.Sprintf(`targets:
+  - path: "%s"
+  - path: "%s"
+    mode: copy
+`, targetFile, copyTarget)), 0644)
+	runAgentsS(t, tempDir, "use", "writer")
+	runAgentsS(t, tempDir, "use", "reviewer", "--for", "2h")
+	expireStack(t, statusFile)
+	os.WriteFile(copyTarget, []byte("Edited by hand."), 0644)
+	// The edited copy cannot be backed up
+	backups := filepath.Join(tempDir, ".local", "state", "agent-smith", "backups")
+	os.MkdirAll(filepath.Dir(backups), 0755)
+	os.WriteFile(backups, nil, 0644)
+
+	out, err = runAgentsS(t, tempDir, "status")
+	if err != nil {
+		t.Fatalf("status failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "switching back to 'writer' failed") || !strings.Contains(out, "Persona: reviewer [ACTIVE]") {
+		t.Errorf("Expected a warning and the status of reviewer, got:\n%s", out)
+	}
+	if data, _ := os.ReadFile(statusFile); !strings.Contains(string(data), "stack:") {
+		t.Errorf("Expected the expired entry to be kept:\n%s", data)
+	}
+}
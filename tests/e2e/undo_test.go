@@ -0,0 +1,116 @@
+package e2e_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUndo(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-undo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "repo", "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+journal_retention: 2
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644)
+	statusFile := filepath.Join(configDir, "status.yaml")
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	os.Chmod(copyTarget, 0600)
+	before, _ := os.ReadFile(statusFile)
+
+	if out, err := runAgentsS(t, tempDir, "unuse"); err != nil {
+		t.Fatalf("unuse failed: %v\nOutput: %s", err, out)
+	}
+	if _, err := os.Lstat(copyTarget); !os.IsNotExist(err) {
+		t.Fatalf("Expected unuse to remove %s", copyTarget)
+	}
+
+	out, err := runAgentsS(t, tempDir, "undo", "--dry-run")
+	if err != nil || !strings.Contains(out, "create-copy") || !strings.Contains(out, "restore-state") {
+		t.Errorf("Unexpected undo plan: %v\n%s", err, out)
+	}
+	if _, err := os.Lstat(copyTarget); !os.IsNotExist(err) {
+		t.Errorf("undo --dry-run must not restore anything")
+	}
+
+	out, err = runAgentsS(t, tempDir, "undo")
+	if err != nil {
+		t.Fatalf("undo failed: %v\nOutput: %s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected canonical link restored, got %q", dest)
+	}
+	if info, err := os.Stat(copyTarget); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected copy restored with its permissions: %v", err)
+	}
+	if after, _ := os.ReadFile(statusFile); string(after) != string(before) {
+		t.Errorf("Expected state restored exactly.\nBefore:\n%s\nAfter:\n%s", before, after)
+	}
+	if out, _ := runAgentsS(t, tempDir, "status"); !strings.Contains(out, "Persona: coder [ACTIVE]") {
+		t.Errorf("Expected coder active after undo, got:\n%s", out)
+	}
+
+	if out, _ := runAgentsS(t, tempDir, "undo"); !strings.Contains(out, "Nothing to undo") {
+		t.Errorf("Expected the journal to be empty, got:\n%s", out)
+	}
+
+	// Undo refuses to clobber later changes
+	if out, err := runAgentsS(t, tempDir, "drop", "coder", "--target-file", copyTarget); err != nil {
+		t.Fatalf("drop failed: %v\nOutput: %s", err, out)
+	}
+	os.WriteFile(copyTarget, []byte("Mine now."), 0644)
+	if out, err := runAgentsS(t, tempDir, "undo"); err == nil || !strings.Contains(out, copyTarget) {
+		t.Errorf("Expected undo to refuse over a changed target, got: %v\n%s", err, out)
+	}
+	if out, err := runAgentsS(t, tempDir, "undo", "--force"); err != nil {
+		t.Fatalf("undo --force failed: %v\nOutput: %s", err, out)
+	}
+	if data, _ := os.ReadFile(copyTarget); string(data) != "Code." {
+		t.Errorf("Expected dropped copy restored, got %q", data)
+	}
+
+	// Only journal_retention commands are kept
+	runAgentsS(t, tempDir, "drop", "coder", "--target-file", copyTarget)
+	runAgentsS(t, tempDir, "use", "writer")
+	runAgentsS(t, tempDir, "drop", "coder")
+	runAgentsS(t, tempDir, "unuse")
+	out, err = runAgentsS(t, tempDir, "undo", "--list", "--output", "json")
+	if err != nil {
+		t.Fatalf("undo --list failed: %v\nOutput: %s", err, out)
+	}
+	var report struct {
+		Entries []struct {
+			Command string `json:"command"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, out)
+	}
+	if len(report.Entries) != 2 || report.Entries[0].Command != "agents unuse" || report.Entries[1].Command != "agents drop coder" {
+		t.Errorf("Expected the two most recent commands, got %+v", report.Entries)
+	}
+}
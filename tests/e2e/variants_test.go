@@ -0,0 +1,124 @@
+package e2e_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTargetVariants(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-variants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	os.MkdirAll(agentsDir, 0755)
+	os.MkdirAll(configDir, 0755)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.gemini-coder.md"), []byte("Code, Gemini."), 0644)
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.writer.md"), []byte("Write."), 0644)
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	geminiFile := filepath.Join(tempDir, ".gemini", "GEMINI.md")
+	geminiLink := filepath.Join(tempDir, "GEMINI-LINK.md")
+	configFile := filepath.Join(configDir, "config.yaml")
+	writeConfig := func(canonicalVariants string) {
+		os.WriteFile(configFile, []byte(fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+targets:
+  - path: "%s"
+    mode: link%s
+  - path: "%s"
+    mode: copy
+    variants:
+      coder: gemini-coder
+  - path: "%s"
+    mode: link
+    variants:
+      coder: gemini-coder
+`, agentsDir, targetFile, targetFile, canonicalVariants, geminiFile, geminiLink)), 0644)
+	}
+	writeConfig("")
+
+	out, err := runAgentsS(t, tempDir, "use", "coder")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "GEMINI.md (gemini-coder)") {
+		t.Errorf("Expected the variant in the output, got:\n%s", out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected the canonical target to link to coder, got %s", dest)
+	}
+	if content, _ := os.ReadFile(geminiFile); string(content) != "Code, Gemini." {
+		t.Errorf("Expected the gemini-coder variant in the copy, got %q", content)
+	}
+	if dest, _ := os.Readlink(geminiLink); filepath.Base(dest) != "AGENTS.gemini-coder.md" {
+		t.Errorf("Expected the link to the gemini-coder variant, got %s", dest)
+	}
+
+	out, err = runAgentsS(t, tempDir, "status")
+	if err != nil {
+		t.Fatalf("status failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "Persona: coder [ACTIVE]") || strings.Contains(out, "DRIFT") || !strings.Contains(out, "as gemini-coder") {
+		t.Errorf("Expected coder active with its variants in sync, got:\n%s", out)
+	}
+
+	// Editing the variant makes its copy stale; reconcile brings the variant back
+	os.WriteFile(filepath.Join(agentsDir, "AGENTS.gemini-coder.md"), []byte("Code better, Gemini."), 0644)
+	out, _ = runAgentsS(t, tempDir, "status", "-o", "json")
+	if !strings.Contains(out, `"status": "STALE"`) || !strings.Contains(out, `"persona": "gemini-coder"`) {
+		t.Errorf("Expected the variant copy to be stale, got:\n%s", out)
+	}
+	if out, err := runAgentsS(t, tempDir, "reconcile"); err != nil {
+		t.Fatalf("reconcile failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(geminiFile); string(content) != "Code better, Gemini." {
+		t.Errorf("Expected reconcile to refresh the variant, got %q", content)
+	}
+
+	out, _ = runAgentsS(t, tempDir, "diff", geminiFile)
+	if !strings.Contains(out, "no differences") {
+		t.Errorf("Expected no differences against the variant, got:\n%s", out)
+	}
+
+	// Personas without a variant apply as usual
+	if out, err := runAgentsS(t, tempDir, "use", "writer"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if content, _ := os.ReadFile(geminiFile); string(content) != "Write." {
+		t.Errorf("Expected writer in the copy, got %q", content)
+	}
+
+	// The canonical target never gets a variant
+	writeConfig("\n    variants:\n      coder: gemini-coder")
+	out, err = runAgentsS(t, tempDir, "use", "coder")
+	if err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+	if !strings.Contains(out, "ignoring variants of the canonical target") {
+		t.Errorf("Expected a warning about canonical variants, got:\n%s", out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.coder.md" {
+		t.Errorf("Expected the canonical target to link to coder, got %s", dest)
+	}
+
+	// A missing variant fails the switch without changing anything
+	writeConfig("")
+	os.Remove(filepath.Join(agentsDir, "AGENTS.gemini-coder.md"))
+	runAgentsS(t, tempDir, "use", "writer")
+	out, err = runAgentsS(t, tempDir, "use", "coder")
+	if err == nil || !strings.Contains(out, "persona 'gemini-coder' not found") {
+		t.Errorf("Expected a missing variant to fail, got %v:\n%s", err, out)
+	}
+	if dest, _ := os.Readlink(targetFile); filepath.Base(dest) != "AGENTS.writer.md" {
+		t.Errorf("Expected writer to stay active, got %s", dest)
+	}
+}
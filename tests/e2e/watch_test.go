@@ -0,0 +1,123 @@
+package e2e_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "agents-e2e-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	agentsDir := filepath.Join(tempDir, "agents")
+	configDir := filepath.Join(tempDir, ".config", "agent-smith")
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	targetFile := filepath.Join(tempDir, "AGENTS.md")
+	copyTarget := filepath.Join(tempDir, "repo", "AGENTS.md")
+	configContent := fmt.Sprintf(`
+agents_dir: ["%s"]
+target_file: "%s"
+watch_interval: 50ms
+targets:
+  - path: "%s"
+    mode: "copy"
+`, agentsDir, targetFile, copyTarget)
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if out, err := runAgentsS(t, tempDir, "use", "coder"); err != nil {
+		t.Fatalf("use failed: %v\nOutput: %s", err, out)
+	}
+
+	cmd := exec.Command(testBinaryPath, "watch", "--debounce", "100ms", "--output", "json")
+	cmd.Env = append(os.Environ(), "HOME="+tempDir,
+		"XDG_CONFIG_HOME="+filepath.Join(tempDir, ".config"),
+		"XDG_DATA_HOME="+filepath.Join(tempDir, ".local", "share"),
+		"XDG_STATE_HOME="+filepath.Join(tempDir, ".local", "state"))
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	// Let the initial reconcile finish before causing drift
+	time.Sleep(300 * time.Millisecond)
+	if err := os.Remove(copyTarget); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the copy to be restored", func() bool {
+		data, _ := os.ReadFile(copyTarget)
+		return string(data) == "Code."
+	})
+
+	// Editing the persona refreshes the stale copy
+	if err := os.WriteFile(filepath.Join(agentsDir, "AGENTS.coder.md"), []byte("Code better."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("the copy to be refreshed", func() bool {
+		data, _ := os.ReadFile(copyTarget)
+		return string(data) == "Code better."
+	})
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("watch did not exit cleanly: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop on SIGTERM")
+	}
+
+	events := map[string]int{}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		var e struct {
+			Event string `json:"event"`
+			Level string `json:"level"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid log line %q: %v", scanner.Text(), err)
+		}
+		events[e.Event]++
+	}
+	if events["start"] != 1 || events["stop"] != 1 || events["change"] < 2 || events["reconcile"] < 3 {
+		t.Errorf("Unexpected events: %v\n%s", events, stdout.String())
+	}
+}